@@ -0,0 +1,133 @@
+// Command apiclient manages the API clients and keys accepted in the X-API-Key header.
+//
+//	apiclient list
+//	apiclient create-client -name web
+//	apiclient create-key -client 1 -name 2026-q4 [-valid-days 180]
+//	apiclient retire-key -key 3 [-grace-days 7]
+//	apiclient disable-key -key 3 | enable-key -key 3
+//	apiclient disable-client -client 1 | enable-client -client 1
+//
+// Rotating a key means creating its replacement, rolling it out, then retiring the old key
+// with a grace period so both work in the meantime.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/utils"
+	"os"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	db := database.SetupDb()
+	defer db.Close()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	name := fs.String("name", "", "name of the client or key")
+	clientID := fs.Int("client", 0, "api_client_id")
+	keyID := fs.Int("key", 0, "api_client_key_id")
+	validDays := fs.Int("valid-days", 0, "days until the new key expires, 0 for no expiry")
+	graceDays := fs.Int("grace-days", 7, "days the retired key keeps working")
+	fs.Parse(args)
+
+	switch cmd {
+	case "list":
+		clients, err := database.GetApiClients(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, client := range clients {
+			fmt.Printf("client %d %q enabled=%t\n", client.ApiClientId, client.Name, client.Enabled)
+			keys, err := database.GetApiClientKeys(client.ApiClientId, db)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, key := range keys {
+				fmt.Printf("  key %d %q prefix=%s enabled=%t valid_from=%s valid_until=%s last_used=%s\n",
+					key.ApiClientKeyId, key.Name, key.KeyPrefix, key.Enabled,
+					key.ValidFrom.Format("2006-01-02"), formatOptional(key.ValidUntil), formatOptional(key.LastUsedAt))
+			}
+		}
+
+	case "create-client":
+		requireFlag(*name != "", "-name")
+		client, err := database.CreateApiClient(database.ApiClient{Name: *name}, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created client %d %q\n", client.ApiClientId, client.Name)
+
+	case "create-key":
+		requireFlag(*clientID != 0, "-client")
+		requireFlag(*name != "", "-name")
+		apiKey, ident, err := utils.GenerateApiKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		key, err := database.CreateApiClientKey(database.ApiClientKey{
+			ApiClientId: *clientID,
+			Name:        *name,
+			KeyPrefix:   ident,
+			KeyHash:     utils.HashToken(apiKey),
+		}, *validDays, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("created key %d %q for client %d\n", key.ApiClientKeyId, key.Name, key.ApiClientId)
+		fmt.Printf("X-API-Key: %s\n", apiKey)
+		fmt.Println("This key is not stored and cannot be shown again.")
+
+	case "retire-key":
+		requireFlag(*keyID != 0, "-key")
+		key, err := database.RetireApiClientKey(*keyID, *graceDays, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("key %d valid until %s\n", key.ApiClientKeyId, formatOptional(key.ValidUntil))
+
+	case "enable-key", "disable-key":
+		requireFlag(*keyID != 0, "-key")
+		key, err := database.SetApiClientKeyEnabled(*keyID, cmd == "enable-key", db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("key %d enabled=%t\n", key.ApiClientKeyId, key.Enabled)
+
+	case "enable-client", "disable-client":
+		requireFlag(*clientID != 0, "-client")
+		client, err := database.SetApiClientEnabled(*clientID, cmd == "enable-client", db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("client %d enabled=%t\n", client.ApiClientId, client.Enabled)
+
+	default:
+		usage()
+	}
+}
+
+func requireFlag(ok bool, flagName string) {
+	if !ok {
+		log.Fatalf("%s is required", flagName)
+	}
+}
+
+func formatOptional(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: apiclient list|create-client|create-key|retire-key|enable-key|disable-key|enable-client|disable-client [flags]")
+	os.Exit(2)
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+)
+
+type ApiClient = models.ApiClient
+type ApiClientKey = models.ApiClientKey
+
+func CreateApiClient(client ApiClient, db *sql.DB) (ApiClient, error) {
+	query := `
+		INSERT INTO api_client (name, enabled, date_created)
+		VALUES ($1, TRUE, CURRENT_TIMESTAMP)
+		RETURNING api_client_id, name, enabled, date_created
+	`
+	err := db.QueryRow(query, client.Name).Scan(
+		&client.ApiClientId,
+		&client.Name,
+		&client.Enabled,
+		&client.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return client, err
+	}
+	return client, nil
+}
+
+func GetApiClients(db *sql.DB) ([]ApiClient, error) {
+	var clients []ApiClient
+	query := `
+		SELECT api_client_id, name, enabled, date_created
+		FROM api_client
+		ORDER BY api_client_id
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var client ApiClient
+		if err := rows.Scan(
+			&client.ApiClientId,
+			&client.Name,
+			&client.Enabled,
+			&client.DateCreated,
+		); err != nil {
+			return clients, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+func SetApiClientEnabled(clientID int, enabled bool, db *sql.DB) (ApiClient, error) {
+	var client ApiClient
+	query := `
+		UPDATE api_client
+		SET enabled = $2
+		WHERE api_client_id = $1
+		RETURNING api_client_id, name, enabled, date_created
+	`
+	err := db.QueryRow(query, clientID, enabled).Scan(
+		&client.ApiClientId,
+		&client.Name,
+		&client.Enabled,
+		&client.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return client, err
+	}
+	return client, nil
+}
+
+// CreateApiClientKey adds a key to a client. validDays of zero creates a key with no end date.
+func CreateApiClientKey(key ApiClientKey, validDays int, db *sql.DB) (ApiClientKey, error) {
+	query := `
+		INSERT INTO api_client_key (api_client_id, name, key_prefix, key_hash, enabled, valid_from, valid_until, date_created)
+		VALUES ($1, $2, $3, $4, TRUE, CURRENT_TIMESTAMP, CASE WHEN $5 > 0 THEN CURRENT_TIMESTAMP + make_interval(days => $5) END, CURRENT_TIMESTAMP)
+		RETURNING api_client_key_id, api_client_id, name, key_prefix, key_hash, enabled, valid_from, valid_until, last_used_at, date_created
+	`
+	err := db.QueryRow(query, key.ApiClientId, key.Name, key.KeyPrefix, key.KeyHash, validDays).Scan(
+		&key.ApiClientKeyId,
+		&key.ApiClientId,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.Enabled,
+		&key.ValidFrom,
+		&key.ValidUntil,
+		&key.LastUsedAt,
+		&key.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return key, err
+	}
+	return key, nil
+}
+
+func GetApiClientKeys(clientID int, db *sql.DB) ([]ApiClientKey, error) {
+	var keys []ApiClientKey
+	query := `
+		SELECT api_client_key_id, api_client_id, name, key_prefix, key_hash, enabled, valid_from, valid_until, last_used_at, date_created
+		FROM api_client_key
+		WHERE api_client_id = $1
+		ORDER BY valid_from DESC
+	`
+	rows, err := db.Query(query, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key ApiClientKey
+		if err := rows.Scan(
+			&key.ApiClientKeyId,
+			&key.ApiClientId,
+			&key.Name,
+			&key.KeyPrefix,
+			&key.KeyHash,
+			&key.Enabled,
+			&key.ValidFrom,
+			&key.ValidUntil,
+			&key.LastUsedAt,
+			&key.DateCreated,
+		); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetUsableApiClientKeyByPrefix finds an enabled key on an enabled client that is inside its
+// validity window. The caller still has to compare the full key hash.
+func GetUsableApiClientKeyByPrefix(prefix string, db *sql.DB) (ApiClientKey, error) {
+	var key ApiClientKey
+	query := `
+		SELECT k.api_client_key_id, k.api_client_id, k.name, k.key_prefix, k.key_hash, k.enabled, k.valid_from, k.valid_until, k.last_used_at, k.date_created
+		FROM api_client_key k
+		JOIN api_client c ON c.api_client_id = k.api_client_id
+		WHERE k.key_prefix = $1
+		AND k.enabled AND c.enabled
+		AND k.valid_from <= CURRENT_TIMESTAMP
+		AND (k.valid_until IS NULL OR k.valid_until > CURRENT_TIMESTAMP)
+	`
+	err := db.QueryRow(query, prefix).Scan(
+		&key.ApiClientKeyId,
+		&key.ApiClientId,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.Enabled,
+		&key.ValidFrom,
+		&key.ValidUntil,
+		&key.LastUsedAt,
+		&key.DateCreated,
+	)
+	if err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+func SetApiClientKeyEnabled(keyID int, enabled bool, db *sql.DB) (ApiClientKey, error) {
+	var key ApiClientKey
+	query := `
+		UPDATE api_client_key
+		SET enabled = $2
+		WHERE api_client_key_id = $1
+		RETURNING api_client_key_id, api_client_id, name, key_prefix, key_hash, enabled, valid_from, valid_until, last_used_at, date_created
+	`
+	err := db.QueryRow(query, keyID, enabled).Scan(
+		&key.ApiClientKeyId,
+		&key.ApiClientId,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.Enabled,
+		&key.ValidFrom,
+		&key.ValidUntil,
+		&key.LastUsedAt,
+		&key.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return key, err
+	}
+	return key, nil
+}
+
+// RetireApiClientKey schedules a key to stop working after graceDays, leaving time for
+// callers to switch to its replacement
+func RetireApiClientKey(keyID int, graceDays int, db *sql.DB) (ApiClientKey, error) {
+	var key ApiClientKey
+	query := `
+		UPDATE api_client_key
+		SET valid_until = LEAST(COALESCE(valid_until, 'infinity'), CURRENT_TIMESTAMP + make_interval(days => $2))
+		WHERE api_client_key_id = $1
+		RETURNING api_client_key_id, api_client_id, name, key_prefix, key_hash, enabled, valid_from, valid_until, last_used_at, date_created
+	`
+	err := db.QueryRow(query, keyID, graceDays).Scan(
+		&key.ApiClientKeyId,
+		&key.ApiClientId,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.Enabled,
+		&key.ValidFrom,
+		&key.ValidUntil,
+		&key.LastUsedAt,
+		&key.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return key, err
+	}
+	return key, nil
+}
+
+// TouchApiClientKey records use of a key, at most once a minute
+func TouchApiClientKey(keyID int, db *sql.DB) error {
+	query := `
+		UPDATE api_client_key
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE api_client_key_id = $1
+		AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`
+	_, err := db.Exec(query, keyID)
+	return err
+}
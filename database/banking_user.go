@@ -2,6 +2,8 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"moneyd/api/models"
 
@@ -16,13 +18,18 @@ type User struct {
 
 
 func CreateUser(user User, db *sql.DB) (User, error) {
-	user.PasswordHash = utils.PasswordHasher(user.PlainPassword);
+	passwordHash, err := utils.HashPassword(user.PlainPassword)
+	if err != nil {
+		log.Print(err)
+		return user, err
+	}
+	user.PasswordHash = passwordHash
 	query := `
         INSERT INTO banking_user (username, email, password_hash, date_created, date_updated)
         VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-        RETURNING banking_user_id, date_created, date_updated
+        RETURNING banking_user_id, role, date_created, date_updated
         `
-	err := db.QueryRow(query, user.Username, user.Email, user.PasswordHash).Scan(&user.BankingUserId, &user.DateCreated, &user.DateUpdated)
+	err = db.QueryRow(query, user.Username, user.Email, user.PasswordHash).Scan(&user.BankingUserId, &user.Role, &user.DateCreated, &user.DateUpdated)
 	if err != nil {
 		log.Print(err)
 		return user, err
@@ -34,11 +41,11 @@ func CreateUser(user User, db *sql.DB) (User, error) {
 func GetUser(userID int, db *sql.DB) (User, error) {
 	var user User
 	query := `
-        SELECT banking_user_id, username, email, password_hash, date_created, date_updated
+        SELECT banking_user_id, username, email, password_hash, role, disabled_at, date_created, date_updated
         FROM banking_user
         WHERE banking_user_id = $1
         `
-	err := db.QueryRow(query, userID).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.DateUpdated)
+	err := db.QueryRow(query, userID).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.DisabledAt, &user.DateCreated, &user.DateUpdated)
 	if err != nil {
 		log.Print(err)
 		return user, err
@@ -58,11 +65,11 @@ func GetUserAuthorized(userID int, authenticatedUserID int, db *sql.DB) (User, e
 func GetUserByEmail(email string, db *sql.DB) (User, error) {
 	var user User
 	query := `
-        SELECT banking_user_id, username, email, password_hash, date_created, date_updated
+        SELECT banking_user_id, username, email, password_hash, role, disabled_at, date_created, date_updated
         FROM banking_user
         WHERE email = $1
         `
-	err := db.QueryRow(query, email).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.PasswordHash, &user.DateCreated, &user.DateUpdated)
+	err := db.QueryRow(query, email).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.DisabledAt, &user.DateCreated, &user.DateUpdated)
 	if err != nil {
 		log.Print(err)
 		return user, err
@@ -72,14 +79,19 @@ func GetUserByEmail(email string, db *sql.DB) (User, error) {
 }
 
 func UpdateUser(userID int, updatedUser User, db *sql.DB) (User, error) {
-	updatedUser.PasswordHash = utils.PasswordHasher(updatedUser.PlainPassword)
+	passwordHash, err := utils.HashPassword(updatedUser.PlainPassword)
+	if err != nil {
+		log.Print(err)
+		return updatedUser, err
+	}
+	updatedUser.PasswordHash = passwordHash
 	query := `
         UPDATE banking_user
         SET username = $1, email = $2, password_hash = $3, date_created = CURRENT_TIMESTAMP
         WHERE banking_user_id = $4
-        RETURNING banking_user_id, username, email, password_hash, date_created, date_updated
+        RETURNING banking_user_id, username, email, password_hash, role, disabled_at, date_created, date_updated
         `
-	err := db.QueryRow(query, updatedUser.Username, updatedUser.Email, updatedUser.PasswordHash, userID).Scan(&updatedUser.BankingUserId, &updatedUser.Username, &updatedUser.Email, &updatedUser.PasswordHash, &updatedUser.DateCreated, &updatedUser.DateUpdated)
+	err = db.QueryRow(query, updatedUser.Username, updatedUser.Email, updatedUser.PasswordHash, userID).Scan(&updatedUser.BankingUserId, &updatedUser.Username, &updatedUser.Email, &updatedUser.PasswordHash, &updatedUser.Role, &updatedUser.DisabledAt, &updatedUser.DateCreated, &updatedUser.DateUpdated)
 	if err != nil {
 		log.Print(err)
 		return updatedUser, err
@@ -100,10 +112,10 @@ func DeleteUser(userID int, db *sql.DB) (User, error) {
 	query := `
         DELETE FROM banking_user
         WHERE banking_user_id = $1
-        RETURNING banking_user_id, username, email, password_hash, date_created, date_updated
+        RETURNING banking_user_id, username, email, password_hash, role, disabled_at, date_created, date_updated
         `
 	var deletedUser User
-	err := db.QueryRow(query, userID).Scan(&deletedUser.BankingUserId, &deletedUser.Username, &deletedUser.Email, &deletedUser.PasswordHash, &deletedUser.DateCreated, &deletedUser.DateUpdated)
+	err := db.QueryRow(query, userID).Scan(&deletedUser.BankingUserId, &deletedUser.Username, &deletedUser.Email, &deletedUser.PasswordHash, &deletedUser.Role, &deletedUser.DisabledAt, &deletedUser.DateCreated, &deletedUser.DateUpdated)
 	if err != nil {
 		log.Print(err)
 		return deletedUser, err
@@ -120,3 +132,131 @@ func DeleteUserAuthorized(userID int, authenticatedUserID int, db *sql.DB) (User
 	return DeleteUser(userID, db)
 }
 
+
+// UpdateUserPassword replaces a user's password without touching the rest of their profile
+func UpdateUserPassword(userID int, plainPassword string, db *sql.DB) error {
+	passwordHash, err := utils.HashPassword(plainPassword)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	query := `
+        UPDATE banking_user
+        SET password_hash = $1, date_updated = CURRENT_TIMESTAMP
+        WHERE banking_user_id = $2
+        `
+	result, err := db.Exec(query, passwordHash, userID)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user has proven they control their email address
+func MarkEmailVerified(userID int, db *sql.DB) error {
+	query := `
+        UPDATE banking_user
+        SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+        WHERE banking_user_id = $1
+        `
+	_, err := db.Exec(query, userID)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+type UserSummary = models.UserSummary
+
+// ErrUnknownRole is returned when an admin tries to give a user a role that doesn't exist
+var ErrUnknownRole = errors.New("unknown role")
+
+// GetUserSummaries lists every user for the admin API, without credentials
+func GetUserSummaries(db *sql.DB) ([]UserSummary, error) {
+	var users []UserSummary
+	query := `
+        SELECT banking_user_id, username, email, role, disabled_at IS NOT NULL, date_created, date_updated
+        FROM banking_user
+        ORDER BY banking_user_id
+        `
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.BankingUserId, &user.Username, &user.Email, &user.Role, &user.Disabled, &user.DateCreated, &user.DateUpdated); err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func GetUserSummary(userID int, db *sql.DB) (UserSummary, error) {
+	var user UserSummary
+	query := `
+        SELECT banking_user_id, username, email, role, disabled_at IS NOT NULL, date_created, date_updated
+        FROM banking_user
+        WHERE banking_user_id = $1
+        `
+	err := db.QueryRow(query, userID).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.Role, &user.Disabled, &user.DateCreated, &user.DateUpdated)
+	if err != nil {
+		log.Print(err)
+		return user, err
+	}
+	return user, nil
+}
+
+// AdminUpdateUser changes a user's role and disabled flag. Their sessions are revoked so the
+// change applies immediately instead of when their current access token expires. A missing user
+// is sql.ErrNoRows.
+func AdminUpdateUser(userID int, user UserSummary, db *sql.DB) (UserSummary, error) {
+	if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
+		return user, fmt.Errorf("%w %q", ErrUnknownRole, user.Role)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE banking_user
+        SET role = $1,
+            disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+            date_updated = CURRENT_TIMESTAMP
+        WHERE banking_user_id = $3
+        RETURNING banking_user_id, username, email, role, disabled_at IS NOT NULL, date_created, date_updated
+        `
+	err = tx.QueryRow(query, user.Role, user.Disabled, userID).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.Role, &user.Disabled, &user.DateCreated, &user.DateUpdated)
+	if err != nil {
+		log.Print(err)
+		return user, err
+	}
+
+	revokeQuery := `
+        UPDATE auth_session
+        SET revoked_at = CURRENT_TIMESTAMP, date_updated = CURRENT_TIMESTAMP
+        WHERE banking_user_id = $1 AND revoked_at IS NULL
+        `
+	if _, err := tx.Exec(revokeQuery, userID); err != nil {
+		log.Print(err)
+		return user, err
+	}
+
+	return user, tx.Commit()
+}
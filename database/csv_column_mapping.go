@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"moneyd/api/models"
+)
+
+type CsvColumnMapping = models.CsvColumnMapping
+
+// GetCsvColumnMappingAuthorized returns the authenticated user's saved mapping for an institution
+func GetCsvColumnMappingAuthorized(institutionId int, authenticatedUserID int, db *sql.DB) (CsvColumnMapping, error) {
+	var mapping CsvColumnMapping
+	var settings []byte
+	query := `
+		SELECT csv_column_mapping_id, banking_user_id, institution_id, settings, date_created, date_updated
+		FROM csv_column_mapping
+		WHERE institution_id = $1 AND banking_user_id = $2
+	`
+	err := db.QueryRow(query, institutionId, authenticatedUserID).Scan(
+		&mapping.CsvColumnMappingId,
+		&mapping.BankingUserId,
+		&mapping.InstitutionId,
+		&settings,
+		&mapping.DateCreated,
+		&mapping.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return mapping, err
+	}
+	return scanCsvColumnMappingSettings(mapping, settings)
+}
+
+// SaveCsvColumnMappingAuthorized creates or replaces the authenticated user's mapping for an institution
+func SaveCsvColumnMappingAuthorized(institutionId int, mapping CsvColumnMapping, authenticatedUserID int, db *sql.DB) (CsvColumnMapping, error) {
+	return saveCsvColumnMapping(db, institutionId, mapping, authenticatedUserID)
+}
+
+func saveCsvColumnMapping(q querier, institutionId int, mapping CsvColumnMapping, authenticatedUserID int) (CsvColumnMapping, error) {
+	settings, err := json.Marshal(mapping)
+	if err != nil {
+		return mapping, err
+	}
+
+	query := `
+		INSERT INTO csv_column_mapping (banking_user_id, institution_id, settings, date_created, date_updated)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (banking_user_id, institution_id)
+		DO UPDATE SET settings = EXCLUDED.settings, date_updated = CURRENT_TIMESTAMP
+		RETURNING csv_column_mapping_id, banking_user_id, institution_id, settings, date_created, date_updated
+	`
+	var saved CsvColumnMapping
+	err = q.QueryRow(query, authenticatedUserID, institutionId, settings).Scan(
+		&saved.CsvColumnMappingId,
+		&saved.BankingUserId,
+		&saved.InstitutionId,
+		&settings,
+		&saved.DateCreated,
+		&saved.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return mapping, err
+	}
+	return scanCsvColumnMappingSettings(saved, settings)
+}
+
+// scanCsvColumnMappingSettings fills a mapping from its stored JSON while keeping the identifying
+// columns, which are authoritative over anything that was serialized alongside the settings
+func scanCsvColumnMappingSettings(row CsvColumnMapping, settings []byte) (CsvColumnMapping, error) {
+	var mapping CsvColumnMapping
+	if err := json.Unmarshal(settings, &mapping); err != nil {
+		log.Print(err)
+		return row, err
+	}
+	mapping.CsvColumnMappingId = row.CsvColumnMappingId
+	mapping.BankingUserId = row.BankingUserId
+	mapping.InstitutionId = row.InstitutionId
+	mapping.DateCreated = row.DateCreated
+	mapping.DateUpdated = row.DateUpdated
+	return mapping, nil
+}
+
+// GetCsvColumnMappingsByUserId lists every institution mapping a user has saved
+func GetCsvColumnMappingsByUserId(userID int, db *sql.DB) ([]CsvColumnMapping, error) {
+	query := `
+		SELECT csv_column_mapping_id, banking_user_id, institution_id, settings, date_created, date_updated
+		FROM csv_column_mapping
+		WHERE banking_user_id = $1
+		ORDER BY institution_id
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := []CsvColumnMapping{}
+	for rows.Next() {
+		var row CsvColumnMapping
+		var settings []byte
+		if err := rows.Scan(
+			&row.CsvColumnMappingId,
+			&row.BankingUserId,
+			&row.InstitutionId,
+			&settings,
+			&row.DateCreated,
+			&row.DateUpdated,
+		); err != nil {
+			return mappings, err
+		}
+		mapping, err := scanCsvColumnMappingSettings(row, settings)
+		if err != nil {
+			return mappings, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
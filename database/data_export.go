@@ -0,0 +1,192 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+	"time"
+)
+
+type DataExport = models.DataExport
+
+const dataExportColumns = `data_export_id, banking_user_id, status, COALESCE(error, ''), COALESCE(archive_size, 0), expires_at, date_created, date_completed`
+
+// CreateDataExport queues a new archive for a user and reports true, unless one is already being
+// built, in which case it returns that one and false. A unique index on pending exports settles
+// concurrent requests.
+func CreateDataExport(userID int, db *sql.DB) (DataExport, bool, error) {
+	insert := `
+		INSERT INTO data_export (banking_user_id, status, date_created)
+		VALUES ($1, 'pending', CURRENT_TIMESTAMP)
+		ON CONFLICT (banking_user_id) WHERE status = 'pending' DO NOTHING
+		RETURNING ` + dataExportColumns
+	pending := `
+		SELECT ` + dataExportColumns + `
+		FROM data_export
+		WHERE banking_user_id = $1 AND status = 'pending'
+	`
+
+	// The pending export we collided with may finish before we read it, so try again
+	for attempt := 0; ; attempt++ {
+		export, err := scanDataExport(db.QueryRow(insert, userID))
+		if err != sql.ErrNoRows {
+			return export, err == nil, err
+		}
+		export, err = scanDataExport(db.QueryRow(pending, userID))
+		if err != sql.ErrNoRows || attempt == 2 {
+			return export, false, err
+		}
+	}
+}
+
+// GetDataExportAuthorized returns one of the authenticated user's exports, without its archive
+func GetDataExportAuthorized(dataExportId int, authenticatedUserID int, db *sql.DB) (DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_export
+		WHERE data_export_id = $1 AND banking_user_id = $2
+	`
+	return scanDataExport(db.QueryRow(query, dataExportId, authenticatedUserID))
+}
+
+// GetDataExportsByUserId lists a user's exports, newest first
+func GetDataExportsByUserId(userID int, db *sql.DB) ([]DataExport, error) {
+	query := `
+		SELECT ` + dataExportColumns + `
+		FROM data_export
+		WHERE banking_user_id = $1
+		ORDER BY date_created DESC
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return exports, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+// GetDataExportArchiveAuthorized returns the path of a finished, unexpired export's zip archive
+func GetDataExportArchiveAuthorized(dataExportId int, authenticatedUserID int, db *sql.DB) (string, error) {
+	var archivePath string
+	query := `
+		SELECT archive_path
+		FROM data_export
+		WHERE data_export_id = $1
+		AND banking_user_id = $2
+		AND status = 'complete'
+		AND archive_path IS NOT NULL
+		AND expires_at > CURRENT_TIMESTAMP
+	`
+	err := db.QueryRow(query, dataExportId, authenticatedUserID).Scan(&archivePath)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// CompleteDataExport records the file holding a finished archive, downloadable for ttl
+func CompleteDataExport(dataExportId int, archivePath string, archiveSize int64, ttl time.Duration, db *sql.DB) error {
+	query := `
+		UPDATE data_export
+		SET status = 'complete',
+		    archive_path = $2,
+		    archive_size = $3,
+		    expires_at = CURRENT_TIMESTAMP + make_interval(secs => $4),
+		    date_completed = CURRENT_TIMESTAMP
+		WHERE data_export_id = $1
+	`
+	_, err := db.Exec(query, dataExportId, archivePath, archiveSize, ttl.Seconds())
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// FailDataExport records why an archive could not be built
+func FailDataExport(dataExportId int, reason string, db *sql.DB) error {
+	query := `
+		UPDATE data_export
+		SET status = 'failed', error = $2, date_completed = CURRENT_TIMESTAMP
+		WHERE data_export_id = $1
+	`
+	_, err := db.Exec(query, dataExportId, reason)
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// FailInterruptedDataExports marks exports that were still pending when the server stopped as
+// failed, since nothing will pick them up again
+func FailInterruptedDataExports(db *sql.DB) (int64, error) {
+	query := `
+		UPDATE data_export
+		SET status = 'failed', error = 'interrupted by a server restart', date_completed = CURRENT_TIMESTAMP
+		WHERE status = 'pending'
+	`
+	result, err := db.Exec(query)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpiredDataExports removes exports whose download window has passed and returns the
+// archive files they leave behind, for the caller to delete
+func DeleteExpiredDataExports(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`DELETE FROM data_export WHERE expires_at < CURRENT_TIMESTAMP RETURNING COALESCE(archive_path, '')`)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			log.Print(err)
+			return paths, err
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, rows.Err()
+}
+
+type dataExportScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDataExport(row dataExportScanner) (DataExport, error) {
+	var export DataExport
+	err := row.Scan(
+		&export.DataExportId,
+		&export.BankingUserId,
+		&export.Status,
+		&export.Error,
+		&export.ArchiveSize,
+		&export.ExpiresAt,
+		&export.DateCreated,
+		&export.DateCompleted,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return export, err
+}
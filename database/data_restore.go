@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"moneyd/api/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+type DataRestore = models.DataRestore
+type DataRestoreResult = models.DataRestoreResult
+
+// ArchiveError reports an export archive whose contents cannot be restored
+type ArchiveError struct {
+	Reason string
+}
+
+func (e *ArchiveError) Error() string {
+	return e.Reason
+}
+
+// ErrAccountNotEmpty refuses a restore into an account that already has statements, which would
+// otherwise end up holding two copies of the same history
+var ErrAccountNotEmpty = errors.New("account already has statements")
+
+// RestoreAccountAuthorized recreates an export archive's statements, transactions and settings
+// for the authenticated user in a single database transaction. Institutions are matched by name,
+// since only administrators create them; every other ID is newly assigned and mapped from the
+// archive's. nextTransactions returns the archive's transactions a chunk at a time, with their
+// original statement IDs, until io.EOF. Any error, including one from nextTransactions, leaves
+// the account untouched.
+func RestoreAccountAuthorized(restore DataRestore, nextTransactions func() ([]Transaction, error), authenticatedUserID int, db *sql.DB) (DataRestoreResult, error) {
+	result := DataRestoreResult{
+		InstitutionIds: make(map[int]int),
+		StatementIds:   make(map[int]int),
+		NotRestored:    []string{},
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Print(err)
+		return result, err
+	}
+	defer tx.Rollback()
+
+	// Locking the user row keeps two concurrent restores from both finding the account empty
+	var hasStatements bool
+	query := `
+		SELECT EXISTS (SELECT 1 FROM statement WHERE banking_user_id = u.banking_user_id)
+		FROM banking_user u
+		WHERE u.banking_user_id = $1
+		FOR UPDATE
+	`
+	if err := tx.QueryRow(query, authenticatedUserID).Scan(&hasStatements); err != nil {
+		log.Print(err)
+		return result, err
+	}
+	if hasStatements {
+		return result, ErrAccountNotEmpty
+	}
+
+	var missing []string
+	for _, institution := range restore.Institutions {
+		var institutionId int
+		err := tx.QueryRow(`
+			SELECT institution_id
+			FROM institution
+			WHERE LOWER(name) = LOWER($1)
+			ORDER BY institution_id
+			LIMIT 1
+		`, institution.Name).Scan(&institutionId)
+		if err == sql.ErrNoRows {
+			missing = append(missing, institution.Name)
+			continue
+		}
+		if err != nil {
+			log.Print(err)
+			return result, err
+		}
+		result.InstitutionIds[institution.InstitutionId] = institutionId
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return result, &ArchiveError{Reason: fmt.Sprintf("institutions not found on this server: %s; an administrator has to add them before restoring", strings.Join(missing, ", "))}
+	}
+
+	for _, statement := range restore.Statements {
+		institutionId, ok := result.InstitutionIds[statement.InstitutionId]
+		if !ok {
+			return result, &ArchiveError{Reason: fmt.Sprintf("statement %d refers to institution %d, which is not in institutions.json", statement.StatementId, statement.InstitutionId)}
+		}
+		if _, seen := result.StatementIds[statement.StatementId]; seen {
+			return result, &ArchiveError{Reason: fmt.Sprintf("statement %d appears twice in statements.json", statement.StatementId)}
+		}
+		dateAdded := statement.DateAdded
+		if dateAdded.IsZero() {
+			dateAdded = time.Now()
+		}
+
+		var statementId int
+		err := tx.QueryRow(`
+			INSERT INTO statement (banking_user_id, institution_id, period_start, period_end, date_added)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING statement_id
+		`, authenticatedUserID, institutionId, statement.PeriodStart, statement.PeriodEnd, dateAdded).Scan(&statementId)
+		if err != nil {
+			log.Print(err)
+			return result, err
+		}
+		result.StatementIds[statement.StatementId] = statementId
+		result.Statements++
+	}
+
+	for {
+		txns, err := nextTransactions()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+
+		for i := range txns {
+			statementId, ok := result.StatementIds[txns[i].StatementId]
+			if !ok {
+				return result, &ArchiveError{Reason: fmt.Sprintf("transaction %d refers to statement %d, which is not in statements.json", txns[i].TransactionId, txns[i].StatementId)}
+			}
+			txns[i].StatementId = statementId
+		}
+		inserted, err := InsertTransactionsTx(tx, txns, nil)
+		if err != nil {
+			log.Print(err)
+			return result, err
+		}
+		result.Transactions += len(inserted)
+	}
+
+	for _, mapping := range restore.CsvColumnMappings {
+		institutionId, ok := result.InstitutionIds[mapping.InstitutionId]
+		if !ok {
+			result.NotRestored = append(result.NotRestored, fmt.Sprintf("CSV column mapping for institution %d, which has no statements in the archive", mapping.InstitutionId))
+			continue
+		}
+		mapping.InstitutionId = institutionId
+		if _, err := saveCsvColumnMapping(tx, institutionId, mapping, authenticatedUserID); err != nil {
+			return result, err
+		}
+		result.CsvColumnMappings++
+	}
+
+	if restore.LedgerAccountMapping != nil {
+		mapping := *restore.LedgerAccountMapping
+		accounts := make(map[int]string, len(mapping.InstitutionAccounts))
+		for archiveId, account := range mapping.InstitutionAccounts {
+			if institutionId, ok := result.InstitutionIds[archiveId]; ok {
+				accounts[institutionId] = account
+			}
+		}
+		mapping.InstitutionAccounts = accounts
+		if _, err := saveLedgerAccountMapping(tx, mapping, authenticatedUserID); err != nil {
+			return result, err
+		}
+		result.LedgerAccountMapping = true
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		return result, err
+	}
+	return result, nil
+}
@@ -2,12 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func SetupDb() *sql.DB {
@@ -48,3 +49,18 @@ func getDbInfo() string {
 	dbInfo := os.Getenv("DATABASE_URL")
 	return dbInfo
 }
+
+// querier is satisfied by both *sql.DB and *sql.Tx, for queries that run on their own or as
+// part of a larger transaction
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// IsForeignKeyViolation reports whether err is Postgres refusing a change because another row
+// still references the one being changed or deleted
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+	"time"
+)
+
+type IdempotencyKey = models.IdempotencyKey
+
+// ClaimIdempotencyKey records a new key for the user, or takes over one whose window has passed.
+// The request hash stays empty until SaveIdempotentResponse, and the claim only lasts for lease so
+// a key whose request never finished is freed for retries. It returns sql.ErrNoRows when the key
+// is already held by an earlier request.
+func ClaimIdempotencyKey(userID int, key string, lease time.Duration, db *sql.DB) (int, error) {
+	var idempotencyKeyId int
+	query := `
+		INSERT INTO idempotency_key (banking_user_id, idempotency_key, request_hash, expires_at, date_created)
+		VALUES ($1, $2, '', CURRENT_TIMESTAMP + make_interval(secs => $3), CURRENT_TIMESTAMP)
+		ON CONFLICT (banking_user_id, idempotency_key) DO UPDATE
+		SET request_hash = '',
+		    response_status = NULL,
+		    response_content_type = NULL,
+		    response_body = NULL,
+		    expires_at = EXCLUDED.expires_at,
+		    date_created = CURRENT_TIMESTAMP
+		WHERE idempotency_key.expires_at <= CURRENT_TIMESTAMP
+		RETURNING idempotency_key_id
+	`
+	err := db.QueryRow(query, userID, key, lease.Seconds()).Scan(&idempotencyKeyId)
+	if err != nil && err != sql.ErrNoRows {
+		log.Print(err)
+	}
+	return idempotencyKeyId, err
+}
+
+func GetIdempotencyKey(userID int, key string, db *sql.DB) (IdempotencyKey, error) {
+	var record IdempotencyKey
+	var status sql.NullInt64
+	var contentType sql.NullString
+	query := `
+		SELECT idempotency_key_id, banking_user_id, idempotency_key, request_hash, response_status, response_content_type, response_body, expires_at, date_created
+		FROM idempotency_key
+		WHERE banking_user_id = $1 AND idempotency_key = $2
+	`
+	err := db.QueryRow(query, userID, key).Scan(
+		&record.IdempotencyKeyId,
+		&record.BankingUserId,
+		&record.Key,
+		&record.RequestHash,
+		&status,
+		&contentType,
+		&record.ResponseBody,
+		&record.ExpiresAt,
+		&record.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return record, err
+	}
+	record.ResponseStatus = int(status.Int64)
+	record.ResponseContentType = contentType.String
+	return record, nil
+}
+
+// SaveIdempotentResponse stores the hash of the request and the response to replay for a claimed
+// key, and keeps them for window
+func SaveIdempotentResponse(idempotencyKeyId int, requestHash string, status int, contentType string, body []byte, window time.Duration, db *sql.DB) error {
+	query := `
+		UPDATE idempotency_key
+		SET request_hash = $2, response_status = $3, response_content_type = $4, response_body = $5,
+		    expires_at = CURRENT_TIMESTAMP + make_interval(secs => $6)
+		WHERE idempotency_key_id = $1
+	`
+	_, err := db.Exec(query, idempotencyKeyId, requestHash, status, contentType, body, window.Seconds())
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a claimed key whose request failed, so a retry runs it again
+func ReleaseIdempotencyKey(idempotencyKeyId int, db *sql.DB) error {
+	query := `DELETE FROM idempotency_key WHERE idempotency_key_id = $1`
+	_, err := db.Exec(query, idempotencyKeyId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys clears keys whose replay window has passed
+func DeleteExpiredIdempotencyKeys(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`DELETE FROM idempotency_key WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
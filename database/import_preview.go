@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"moneyd/api/models"
+	"time"
+)
+
+type ImportPreview = models.ImportPreview
+
+const importPreviewColumns = `import_preview_id, banking_user_id, statement, csv_column_mapping, rows, errors, expires_at, committed_at, date_created`
+
+// CreateImportPreview stores a parsed import until it is committed or ttl passes
+func CreateImportPreview(preview ImportPreview, ttl time.Duration, db *sql.DB) (ImportPreview, error) {
+	statement, err := json.Marshal(preview.Statement)
+	if err != nil {
+		return preview, err
+	}
+	mapping, err := json.Marshal(preview.CsvColumnMapping)
+	if err != nil {
+		return preview, err
+	}
+	rows, err := json.Marshal(preview.Rows)
+	if err != nil {
+		return preview, err
+	}
+	rowErrors, err := json.Marshal(preview.Errors)
+	if err != nil {
+		return preview, err
+	}
+
+	query := `
+		INSERT INTO import_preview (banking_user_id, statement, csv_column_mapping, rows, errors, expires_at, date_created)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + make_interval(secs => $6), CURRENT_TIMESTAMP)
+		RETURNING ` + importPreviewColumns
+	return scanImportPreview(db.QueryRow(query, preview.BankingUserId, statement, mapping, rows, rowErrors, ttl.Seconds()))
+}
+
+// GetImportPreviewAuthorized returns one of the authenticated user's previews, committed or not
+func GetImportPreviewAuthorized(previewId int, authenticatedUserID int, db *sql.DB) (ImportPreview, error) {
+	query := `
+		SELECT ` + importPreviewColumns + `
+		FROM import_preview
+		WHERE import_preview_id = $1 AND banking_user_id = $2
+	`
+	return scanImportPreview(db.QueryRow(query, previewId, authenticatedUserID))
+}
+
+// ClaimImportPreviewAuthorized marks an unexpired, uncommitted preview as committed and returns it.
+// Concurrent commits of the same preview see sql.ErrNoRows for all but one caller.
+func ClaimImportPreviewAuthorized(previewId int, authenticatedUserID int, db *sql.DB) (ImportPreview, error) {
+	query := `
+		UPDATE import_preview
+		SET committed_at = CURRENT_TIMESTAMP
+		WHERE import_preview_id = $1
+		AND banking_user_id = $2
+		AND committed_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+		RETURNING ` + importPreviewColumns
+	return scanImportPreview(db.QueryRow(query, previewId, authenticatedUserID))
+}
+
+// ReleaseImportPreview reopens a claimed preview whose commit failed so it can be retried
+func ReleaseImportPreview(previewId int, db *sql.DB) error {
+	query := `
+		UPDATE import_preview
+		SET committed_at = NULL
+		WHERE import_preview_id = $1
+	`
+	_, err := db.Exec(query, previewId)
+	if err != nil {
+		log.Print(err)
+	}
+	return err
+}
+
+func scanImportPreview(row *sql.Row) (ImportPreview, error) {
+	var preview ImportPreview
+	var statement, mapping, rows, rowErrors []byte
+	err := row.Scan(
+		&preview.ImportPreviewId,
+		&preview.BankingUserId,
+		&statement,
+		&mapping,
+		&rows,
+		&rowErrors,
+		&preview.ExpiresAt,
+		&preview.CommittedAt,
+		&preview.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return preview, err
+	}
+
+	if statement != nil {
+		if err := json.Unmarshal(statement, &preview.Statement); err != nil {
+			return preview, err
+		}
+	}
+	if mapping != nil {
+		if err := json.Unmarshal(mapping, &preview.CsvColumnMapping); err != nil {
+			return preview, err
+		}
+	}
+	if err := json.Unmarshal(rows, &preview.Rows); err != nil {
+		return preview, err
+	}
+	if err := json.Unmarshal(rowErrors, &preview.Errors); err != nil {
+		return preview, err
+	}
+	return preview, nil
+}
@@ -67,3 +67,116 @@ func GetInstitutions(db *sql.DB) ([]Institution, error) {
 
 	return institutions, nil
 }
+
+// GetInstitutionsByUserId lists the institutions a user has statements with
+func GetInstitutionsByUserId(userID int, db *sql.DB) ([]Institution, error) {
+	institutions := []Institution{}
+	query := `
+		SELECT DISTINCT i.institution_id, i.name
+		FROM institution i
+		JOIN statement s ON s.institution_id = i.institution_id
+		WHERE s.banking_user_id = $1
+		ORDER BY i.institution_id
+		`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inst Institution
+		if err := rows.Scan(
+			&inst.InstitutionId,
+			&inst.Name,
+		); err != nil {
+			return institutions, err
+		}
+		institutions = append(institutions, inst)
+	}
+
+	return institutions, rows.Err()
+}
+
+func GetInstitution(institutionId int, db *sql.DB) (Institution, error) {
+	var institution Institution
+	query := `
+		SELECT institution_id, name
+		FROM institution
+		WHERE institution_id = $1
+		`
+	err := db.QueryRow(query, institutionId).Scan(
+		&institution.InstitutionId,
+		&institution.Name,
+	)
+	if err != nil {
+		log.Print(err)
+		return institution, err
+	}
+
+	return institution, nil
+}
+
+// GetInstitutionByName finds an institution by name, ignoring case, so imported files that
+// name their bank can be matched to it
+func GetInstitutionByName(name string, db *sql.DB) (Institution, error) {
+	var institution Institution
+	query := `
+		SELECT institution_id, name
+		FROM institution
+		WHERE LOWER(name) = LOWER($1)
+		ORDER BY institution_id
+		LIMIT 1
+		`
+	err := db.QueryRow(query, name).Scan(
+		&institution.InstitutionId,
+		&institution.Name,
+	)
+	if err != nil {
+		log.Print(err)
+		return institution, err
+	}
+
+	return institution, nil
+}
+
+func UpdateInstitution(institutionId int, institution Institution, db *sql.DB) (Institution, error) {
+	query := `
+		UPDATE institution
+		SET name = $1
+		WHERE institution_id = $2
+		RETURNING institution_id, name
+		`
+	err := db.QueryRow(query,
+		institution.Name,
+		institutionId,
+	).Scan(
+		&institution.InstitutionId,
+		&institution.Name,
+	)
+	if err != nil {
+		log.Print(err)
+		return institution, err
+	}
+
+	return institution, nil
+}
+
+func DeleteInstitution(institutionId int, db *sql.DB) (Institution, error) {
+	var institution Institution
+	query := `
+		DELETE FROM institution
+		WHERE institution_id = $1
+		RETURNING institution_id, name
+		`
+	err := db.QueryRow(query, institutionId).Scan(
+		&institution.InstitutionId,
+		&institution.Name,
+	)
+	if err != nil {
+		log.Print(err)
+		return institution, err
+	}
+
+	return institution, nil
+}
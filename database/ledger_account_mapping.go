@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"moneyd/api/models"
+)
+
+type LedgerAccountMapping = models.LedgerAccountMapping
+
+// GetLedgerAccountMappingAuthorized returns the authenticated user's saved account mapping
+func GetLedgerAccountMappingAuthorized(authenticatedUserID int, db *sql.DB) (LedgerAccountMapping, error) {
+	var mapping LedgerAccountMapping
+	var settings []byte
+	query := `
+		SELECT ledger_account_mapping_id, banking_user_id, settings, date_created, date_updated
+		FROM ledger_account_mapping
+		WHERE banking_user_id = $1
+	`
+	err := db.QueryRow(query, authenticatedUserID).Scan(
+		&mapping.LedgerAccountMappingId,
+		&mapping.BankingUserId,
+		&settings,
+		&mapping.DateCreated,
+		&mapping.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return mapping, err
+	}
+	return scanLedgerAccountMappingSettings(mapping, settings)
+}
+
+// SaveLedgerAccountMappingAuthorized creates or replaces the authenticated user's account mapping
+func SaveLedgerAccountMappingAuthorized(mapping LedgerAccountMapping, authenticatedUserID int, db *sql.DB) (LedgerAccountMapping, error) {
+	return saveLedgerAccountMapping(db, mapping, authenticatedUserID)
+}
+
+func saveLedgerAccountMapping(q querier, mapping LedgerAccountMapping, authenticatedUserID int) (LedgerAccountMapping, error) {
+	settings, err := json.Marshal(mapping)
+	if err != nil {
+		return mapping, err
+	}
+
+	query := `
+		INSERT INTO ledger_account_mapping (banking_user_id, settings, date_created, date_updated)
+		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (banking_user_id)
+		DO UPDATE SET settings = EXCLUDED.settings, date_updated = CURRENT_TIMESTAMP
+		RETURNING ledger_account_mapping_id, banking_user_id, settings, date_created, date_updated
+	`
+	var saved LedgerAccountMapping
+	err = q.QueryRow(query, authenticatedUserID, settings).Scan(
+		&saved.LedgerAccountMappingId,
+		&saved.BankingUserId,
+		&settings,
+		&saved.DateCreated,
+		&saved.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return mapping, err
+	}
+	return scanLedgerAccountMappingSettings(saved, settings)
+}
+
+// scanLedgerAccountMappingSettings fills a mapping from its stored JSON while keeping the
+// identifying columns
+func scanLedgerAccountMappingSettings(row LedgerAccountMapping, settings []byte) (LedgerAccountMapping, error) {
+	var mapping LedgerAccountMapping
+	if err := json.Unmarshal(settings, &mapping); err != nil {
+		log.Print(err)
+		return row, err
+	}
+	mapping.LedgerAccountMappingId = row.LedgerAccountMappingId
+	mapping.BankingUserId = row.BankingUserId
+	mapping.DateCreated = row.DateCreated
+	mapping.DateUpdated = row.DateUpdated
+	return mapping, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetLoginLockout returns how many seconds remain on the longest active lockout among keys,
+// or zero if none of them are locked
+func GetLoginLockout(keys []string, db *sql.DB) (int, error) {
+	var retryAfter int
+	query := `
+		SELECT COALESCE(CEIL(MAX(EXTRACT(EPOCH FROM (locked_until - CURRENT_TIMESTAMP)))), 0)::INTEGER
+		FROM login_throttle
+		WHERE throttle_key = ANY($1) AND locked_until > CURRENT_TIMESTAMP
+	`
+	err := db.QueryRow(query, pq.Array(keys)).Scan(&retryAfter)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return retryAfter, nil
+}
+
+// RecordLoginFailure bumps the failure counter for key and returns the new count. Counters
+// start over once window has passed since the previous failure.
+func RecordLoginFailure(key string, window time.Duration, db *sql.DB) (int, error) {
+	var failedCount int
+	query := `
+		INSERT INTO login_throttle (throttle_key, failed_count, last_failed_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failed_count = CASE
+		        WHEN login_throttle.last_failed_at < CURRENT_TIMESTAMP - make_interval(secs => $2) THEN 1
+		        ELSE login_throttle.failed_count + 1
+		    END,
+		    last_failed_at = CURRENT_TIMESTAMP
+		RETURNING failed_count
+	`
+	err := db.QueryRow(query, key, window.Seconds()).Scan(&failedCount)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return failedCount, nil
+}
+
+// LockLogin blocks further attempts for key until lockout has passed
+func LockLogin(key string, lockout time.Duration, db *sql.DB) error {
+	query := `
+		UPDATE login_throttle
+		SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE throttle_key = $1
+	`
+	_, err := db.Exec(query, key, lockout.Seconds())
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+// ClearLoginThrottle forgets past failures for key, typically after a successful login
+func ClearLoginThrottle(key string, db *sql.DB) error {
+	_, err := db.Exec(`DELETE FROM login_throttle WHERE throttle_key = $1`, key)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+)
+
+type UserMfa = models.UserMfa
+
+func GetUserMfa(userID int, db *sql.DB) (UserMfa, error) {
+	var mfa UserMfa
+	query := `
+		SELECT banking_user_id, totp_secret, last_used_step, enabled_at, date_created, date_updated
+		FROM user_mfa
+		WHERE banking_user_id = $1
+	`
+	err := db.QueryRow(query, userID).Scan(
+		&mfa.BankingUserId,
+		&mfa.TotpSecret,
+		&mfa.LastUsedStep,
+		&mfa.EnabledAt,
+		&mfa.DateCreated,
+		&mfa.DateUpdated,
+	)
+	if err != nil {
+		return mfa, err
+	}
+	return mfa, nil
+}
+
+// StartTotpEnrollment stores a new, unconfirmed secret for the user. An already enabled
+// second factor is left untouched and sql.ErrNoRows is returned instead.
+func StartTotpEnrollment(userID int, secret string, db *sql.DB) (UserMfa, error) {
+	var mfa UserMfa
+	query := `
+		INSERT INTO user_mfa (banking_user_id, totp_secret, last_used_step, enabled_at, date_created, date_updated)
+		VALUES ($1, $2, 0, NULL, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (banking_user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, date_updated = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL
+		RETURNING banking_user_id, totp_secret, last_used_step, enabled_at, date_created, date_updated
+	`
+	err := db.QueryRow(query, userID, secret).Scan(
+		&mfa.BankingUserId,
+		&mfa.TotpSecret,
+		&mfa.LastUsedStep,
+		&mfa.EnabledAt,
+		&mfa.DateCreated,
+		&mfa.DateUpdated,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return mfa, err
+	}
+	return mfa, nil
+}
+
+// ConsumeTotpStep marks a time step as used. It fails with sql.ErrNoRows when the step is not
+// newer than the last accepted one, which stops a captured code from being replayed.
+func ConsumeTotpStep(userID int, step int64, db *sql.DB) error {
+	return consumeTotpStep(db, userID, step, false)
+}
+
+// ConfirmTotpEnrollment consumes the step that proved the pending enrollment, enables it and
+// stores the first recovery codes together, so MFA is never enabled without recovery codes.
+func ConfirmTotpEnrollment(userID int, step int64, codeHashes []string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := consumeTotpStep(tx, userID, step, true); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// consumeTotpStep confirms a pending enrollment in the same statement when enable is true
+func consumeTotpStep(q querier, userID int, step int64, enable bool) error {
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $2,
+		    enabled_at = CASE WHEN $3 THEN COALESCE(enabled_at, CURRENT_TIMESTAMP) ELSE enabled_at END,
+		    date_updated = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $1 AND last_used_step < $2
+	`
+	result, err := q.Exec(query, userID, step, enable)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DisableMfa removes the user's second factor and any remaining recovery codes
+func DisableMfa(userID int, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_code WHERE banking_user_id = $1`, userID); err != nil {
+		log.Print(err)
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE banking_user_id = $1`, userID); err != nil {
+		log.Print(err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes discards the user's old recovery codes and stores the given hashes
+func replaceRecoveryCodes(q querier, userID int, codeHashes []string) error {
+	if _, err := q.Exec(`DELETE FROM mfa_recovery_code WHERE banking_user_id = $1`, userID); err != nil {
+		log.Print(err)
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		query := `
+			INSERT INTO mfa_recovery_code (banking_user_id, code_hash, date_created)
+			VALUES ($1, $2, CURRENT_TIMESTAMP)
+		`
+		if _, err := q.Exec(query, userID, hash); err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode burns an unused recovery code, returning sql.ErrNoRows if there is none to burn
+func UseRecoveryCode(userID int, codeHash string, db *sql.DB) error {
+	query := `
+		UPDATE mfa_recovery_code
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	result, err := db.Exec(query, userID, codeHash)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
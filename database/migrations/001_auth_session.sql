@@ -0,0 +1,14 @@
+-- Server-side sessions backing access/refresh token pairs issued by /auth/login.
+CREATE TABLE IF NOT EXISTS auth_session (
+    auth_session_id             SERIAL PRIMARY KEY,
+    banking_user_id             INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    refresh_token_hash          TEXT NOT NULL UNIQUE,
+    previous_refresh_token_hash TEXT,
+    expires_at                  TIMESTAMP NOT NULL,
+    revoked_at                  TIMESTAMP,
+    date_created                TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_updated                TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS auth_session_banking_user_id_idx ON auth_session (banking_user_id);
+CREATE INDEX IF NOT EXISTS auth_session_previous_refresh_token_hash_idx ON auth_session (previous_refresh_token_hash);
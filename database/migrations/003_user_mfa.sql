@@ -0,0 +1,18 @@
+-- TOTP second factor. A row with a NULL enabled_at is an enrollment that has not been confirmed yet.
+CREATE TABLE IF NOT EXISTS user_mfa (
+    banking_user_id INTEGER PRIMARY KEY REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    totp_secret     TEXT NOT NULL,
+    last_used_step  BIGINT NOT NULL DEFAULT 0,
+    enabled_at      TIMESTAMP,
+    date_created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_updated    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_code (
+    mfa_recovery_code_id SERIAL PRIMARY KEY,
+    banking_user_id      INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    code_hash            TEXT NOT NULL,
+    used_at              TIMESTAMP,
+    date_created         TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (banking_user_id, code_hash)
+);
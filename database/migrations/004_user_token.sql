@@ -0,0 +1,14 @@
+-- Single-use tokens mailed to users for password resets and email verification.
+CREATE TABLE IF NOT EXISTS user_token (
+    user_token_id   SERIAL PRIMARY KEY,
+    banking_user_id INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    purpose         TEXT NOT NULL,
+    token_hash      TEXT NOT NULL UNIQUE,
+    expires_at      TIMESTAMP NOT NULL,
+    used_at         TIMESTAMP,
+    date_created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS user_token_banking_user_id_idx ON user_token (banking_user_id, purpose);
+
+ALTER TABLE banking_user ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMP;
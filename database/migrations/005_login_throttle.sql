@@ -0,0 +1,7 @@
+-- Failed login counters keyed by account ("email:<address>") or client ("ip:<address>").
+CREATE TABLE IF NOT EXISTS login_throttle (
+    throttle_key   TEXT PRIMARY KEY,
+    failed_count   INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until   TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- Long-lived, scoped bearer tokens for scripts. Only a hash of the token is stored.
+CREATE TABLE IF NOT EXISTS personal_access_token (
+    personal_access_token_id SERIAL PRIMARY KEY,
+    banking_user_id          INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    name                     TEXT NOT NULL,
+    token_hash               TEXT NOT NULL UNIQUE,
+    token_prefix             TEXT NOT NULL,
+    scopes                   TEXT[] NOT NULL,
+    expires_at               TIMESTAMP,
+    last_used_at             TIMESTAMP,
+    revoked_at               TIMESTAMP,
+    date_created             TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS personal_access_token_banking_user_id_idx ON personal_access_token (banking_user_id);
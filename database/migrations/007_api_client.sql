@@ -0,0 +1,21 @@
+-- Callers of the API (frontends, scripts) and the keys they present in X-API-Key.
+-- A client can hold several keys with overlapping validity so keys can be rotated without downtime.
+CREATE TABLE IF NOT EXISTS api_client (
+    api_client_id SERIAL PRIMARY KEY,
+    name          TEXT NOT NULL UNIQUE,
+    enabled       BOOLEAN NOT NULL DEFAULT TRUE,
+    date_created  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS api_client_key (
+    api_client_key_id SERIAL PRIMARY KEY,
+    api_client_id     INTEGER NOT NULL REFERENCES api_client (api_client_id) ON DELETE CASCADE,
+    name              TEXT NOT NULL,
+    key_prefix        TEXT NOT NULL UNIQUE,
+    key_hash          TEXT NOT NULL,
+    enabled           BOOLEAN NOT NULL DEFAULT TRUE,
+    valid_from        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    valid_until       TIMESTAMP,
+    last_used_at      TIMESTAMP,
+    date_created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+-- External identities (issuer + subject) linked to local users for OpenID Connect login.
+CREATE TABLE IF NOT EXISTS user_identity (
+    user_identity_id SERIAL PRIMARY KEY,
+    banking_user_id  INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    issuer           TEXT NOT NULL,
+    subject          TEXT NOT NULL,
+    email            TEXT NOT NULL DEFAULT '',
+    date_created     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (issuer, subject)
+);
+
+-- In-flight authorization requests, keyed by a hash of the state parameter.
+CREATE TABLE IF NOT EXISTS oidc_login_state (
+    state_hash    TEXT PRIMARY KEY,
+    code_verifier TEXT NOT NULL,
+    nonce         TEXT NOT NULL,
+    expires_at    TIMESTAMP NOT NULL
+);
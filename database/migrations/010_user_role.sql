@@ -0,0 +1,5 @@
+-- Roles for the admin API and a switch to lock users out without deleting their data.
+-- Promote the first administrator by hand:
+--   UPDATE banking_user SET role = 'admin' WHERE email = 'you@example.com';
+ALTER TABLE banking_user ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+ALTER TABLE banking_user ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
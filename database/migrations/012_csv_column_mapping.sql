@@ -0,0 +1,10 @@
+-- How a user's CSV exports from an institution map onto transactions, saved so they only map a bank once.
+CREATE TABLE IF NOT EXISTS csv_column_mapping (
+    csv_column_mapping_id SERIAL PRIMARY KEY,
+    banking_user_id       INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    institution_id        INTEGER NOT NULL REFERENCES institution (institution_id) ON DELETE CASCADE,
+    settings              JSONB NOT NULL,
+    date_created          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_updated          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (banking_user_id, institution_id)
+);
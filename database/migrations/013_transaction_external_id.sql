@@ -0,0 +1,6 @@
+-- The identifier a bank assigns to a transaction (OFX FITID), kept so re-imports can be recognised.
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS external_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_statement_external_id
+    ON transaction (statement_id, external_id)
+    WHERE external_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Details only some import formats carry: the value date alongside the booking date
+-- (transaction_date), and who was on the other side of the transaction.
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS value_date DATE;
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS counterparty_name TEXT;
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS counterparty_account TEXT;
@@ -0,0 +1,14 @@
+-- Parsed and validated imports waiting for the user to commit them. Rows, errors and the target
+-- statement are kept as JSON exactly as they were shown in the preview.
+CREATE TABLE IF NOT EXISTS import_preview (
+    import_preview_id SERIAL PRIMARY KEY,
+    banking_user_id   INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    statement         JSONB,
+    rows              JSONB NOT NULL,
+    errors            JSONB NOT NULL,
+    expires_at        TIMESTAMP NOT NULL,
+    committed_at      TIMESTAMP,
+    date_created      TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS import_preview_banking_user_id_idx ON import_preview (banking_user_id);
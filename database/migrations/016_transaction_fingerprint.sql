@@ -0,0 +1,44 @@
+-- Fingerprints identify a transaction across re-imports: the bank's identifier when there is one,
+-- otherwise date, amount and normalised description, always within the statement's institution.
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS fingerprint TEXT;
+
+CREATE OR REPLACE FUNCTION transaction_fingerprint(
+    institution_id   INTEGER,
+    external_id      TEXT,
+    transaction_date DATE,
+    amount_cents     BIGINT,
+    description      TEXT
+) RETURNS TEXT LANGUAGE SQL IMMUTABLE AS $$
+    SELECT encode(sha256(convert_to(
+        CASE WHEN COALESCE(external_id, '') <> ''
+            THEN 'ext|' || institution_id || '|' || external_id
+            ELSE 'txn|' || institution_id || '|' || to_char(transaction_date, 'YYYY-MM-DD') || '|' || amount_cents
+                || '|' || trim(regexp_replace(lower(COALESCE(description, '')), '[^a-z0-9]+', ' ', 'g'))
+        END, 'UTF8')), 'hex')
+$$;
+
+CREATE OR REPLACE FUNCTION set_transaction_fingerprint() RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+    NEW.fingerprint := transaction_fingerprint(
+        (SELECT institution_id FROM statement WHERE statement_id = NEW.statement_id),
+        NEW.external_id,
+        NEW.transaction_date::DATE,
+        (NEW.amount * 100)::BIGINT,
+        NEW.description
+    );
+    RETURN NEW;
+END
+$$;
+
+DROP TRIGGER IF EXISTS transaction_fingerprint_trigger ON transaction;
+CREATE TRIGGER transaction_fingerprint_trigger
+    BEFORE INSERT OR UPDATE OF statement_id, external_id, transaction_date, amount, description ON transaction
+    FOR EACH ROW EXECUTE FUNCTION set_transaction_fingerprint();
+
+UPDATE transaction t
+SET fingerprint = transaction_fingerprint(s.institution_id, t.external_id, t.transaction_date::DATE, (t.amount * 100)::BIGINT, t.description)
+FROM statement s
+WHERE s.statement_id = t.statement_id
+AND t.fingerprint IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_fingerprint ON transaction (fingerprint);
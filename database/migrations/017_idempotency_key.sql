@@ -0,0 +1,16 @@
+-- The first response to each Idempotency-Key a user sends, replayed when a client retries.
+-- response_status stays NULL while the original request is still being handled.
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    idempotency_key_id    SERIAL PRIMARY KEY,
+    banking_user_id       INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    idempotency_key       TEXT NOT NULL,
+    request_hash          TEXT NOT NULL,
+    response_status       INTEGER,
+    response_content_type TEXT,
+    response_body         BYTEA,
+    expires_at            TIMESTAMP NOT NULL,
+    date_created          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (banking_user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at_idx ON idempotency_key (expires_at);
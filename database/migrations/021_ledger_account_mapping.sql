@@ -0,0 +1,8 @@
+-- How a user's institutions and transaction types map onto plain-text accounting account names.
+CREATE TABLE IF NOT EXISTS ledger_account_mapping (
+    ledger_account_mapping_id SERIAL PRIMARY KEY,
+    banking_user_id           INTEGER NOT NULL UNIQUE REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    settings                  JSONB NOT NULL,
+    date_created              TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_updated              TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
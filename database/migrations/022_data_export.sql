@@ -0,0 +1,14 @@
+-- Account data exports ("takeout" archives), built in the background and downloadable until expires_at.
+CREATE TABLE IF NOT EXISTS data_export (
+    data_export_id  SERIAL PRIMARY KEY,
+    banking_user_id INTEGER NOT NULL REFERENCES banking_user (banking_user_id) ON DELETE CASCADE,
+    status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'complete', 'failed')),
+    error           TEXT,
+    archive         BYTEA,
+    archive_size    BIGINT,
+    expires_at      TIMESTAMP,
+    date_created    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    date_completed  TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS data_export_banking_user_id_idx ON data_export (banking_user_id);
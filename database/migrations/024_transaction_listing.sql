@@ -0,0 +1,3 @@
+-- Transaction listings are newest first by default and page on (transaction_date, transaction_id).
+CREATE INDEX IF NOT EXISTS idx_transaction_statement_date
+    ON transaction (statement_id, transaction_date, transaction_id);
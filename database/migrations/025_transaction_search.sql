@@ -0,0 +1,19 @@
+-- Full-text search over the free text of a transaction: the description, weighted above the
+-- counterparty name. Trigram indexes catch what stemming cannot, such as misspellings and
+-- fragments of merchant codes.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE transaction ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(description, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(counterparty_name, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_transaction_search_vector
+    ON transaction USING GIN (search_vector);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_description_trgm
+    ON transaction USING GIN (description gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_counterparty_name_trgm
+    ON transaction USING GIN (counterparty_name gin_trgm_ops);
@@ -0,0 +1,23 @@
+-- 016 drops every character outside a-z and 0-9 from descriptions, so descriptions
+-- in Cyrillic, Greek, CJK and other scripts all normalise to "" and any two such transactions on
+-- the same date for the same amount look like duplicates. Keep letters in every script and
+-- recompute the fingerprints already stored.
+CREATE OR REPLACE FUNCTION transaction_fingerprint(
+    institution_id   INTEGER,
+    external_id      TEXT,
+    transaction_date DATE,
+    amount_cents     BIGINT,
+    description      TEXT
+) RETURNS TEXT LANGUAGE SQL IMMUTABLE AS $$
+    SELECT encode(sha256(convert_to(
+        CASE WHEN COALESCE(external_id, '') <> ''
+            THEN 'ext|' || institution_id || '|' || external_id
+            ELSE 'txn|' || institution_id || '|' || to_char(transaction_date, 'YYYY-MM-DD') || '|' || amount_cents
+                || '|' || trim(regexp_replace(lower(COALESCE(description, '')), '[[:space:][:punct:]]+', ' ', 'g'))
+        END, 'UTF8')), 'hex')
+$$;
+
+UPDATE transaction t
+SET fingerprint = transaction_fingerprint(s.institution_id, t.external_id, t.transaction_date::DATE, (t.amount * 100)::BIGINT, t.description)
+FROM statement s
+WHERE s.statement_id = t.statement_id;
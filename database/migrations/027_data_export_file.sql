@@ -0,0 +1,20 @@
+-- Archives are written to files under DATA_EXPORT_DIR rather than stored in the row, so large
+-- accounts cost neither a full copy in server memory nor a BYTEA of the same size.
+ALTER TABLE data_export ADD COLUMN IF NOT EXISTS archive_path TEXT;
+ALTER TABLE data_export DROP COLUMN IF EXISTS archive;
+
+-- At most one export per user is built at a time; older duplicates from before this index are
+-- failed so it can be created.
+UPDATE data_export d
+SET status = 'failed', error = 'superseded by a newer export', date_completed = CURRENT_TIMESTAMP
+WHERE d.status = 'pending'
+AND EXISTS (
+    SELECT 1 FROM data_export n
+    WHERE n.banking_user_id = d.banking_user_id
+    AND n.status = 'pending'
+    AND n.data_export_id > d.data_export_id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS data_export_pending_banking_user_id_idx
+    ON data_export (banking_user_id)
+    WHERE status = 'pending';
@@ -0,0 +1,3 @@
+-- A CSV column mapping the upload asked to save, held with the preview and only stored for the
+-- institution once the preview is committed.
+ALTER TABLE import_preview ADD COLUMN IF NOT EXISTS csv_column_mapping JSONB;
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+
+	"github.com/lib/pq"
+)
+
+type PersonalAccessToken = models.PersonalAccessToken
+
+// CreatePersonalAccessToken stores a new token. expiresInDays of zero creates a token that never expires.
+func CreatePersonalAccessToken(pat PersonalAccessToken, expiresInDays int, db *sql.DB) (PersonalAccessToken, error) {
+	query := `
+		INSERT INTO personal_access_token (banking_user_id, name, token_hash, token_prefix, scopes, expires_at, date_created)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 > 0 THEN CURRENT_TIMESTAMP + make_interval(days => $6) END, CURRENT_TIMESTAMP)
+		RETURNING personal_access_token_id, banking_user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, date_created
+	`
+	err := db.QueryRow(
+		query,
+		pat.BankingUserId,
+		pat.Name,
+		pat.TokenHash,
+		pat.TokenPrefix,
+		pq.Array(pat.Scopes),
+		expiresInDays,
+	).Scan(
+		&pat.PersonalAccessTokenId,
+		&pat.BankingUserId,
+		&pat.Name,
+		&pat.TokenHash,
+		&pat.TokenPrefix,
+		pq.Array(&pat.Scopes),
+		&pat.ExpiresAt,
+		&pat.LastUsedAt,
+		&pat.RevokedAt,
+		&pat.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return pat, err
+	}
+	return pat, nil
+}
+
+// GetActivePersonalAccessTokenByHash looks up a token presented to AuthMiddleware, ignoring
+// tokens that have been revoked or have expired and tokens of disabled users
+func GetActivePersonalAccessTokenByHash(tokenHash string, db *sql.DB) (PersonalAccessToken, error) {
+	var pat PersonalAccessToken
+	query := `
+		SELECT t.personal_access_token_id, t.banking_user_id, t.name, t.token_hash, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.revoked_at, t.date_created
+		FROM personal_access_token t
+		JOIN banking_user u ON u.banking_user_id = t.banking_user_id
+		WHERE t.token_hash = $1
+		AND t.revoked_at IS NULL
+		AND (t.expires_at IS NULL OR t.expires_at > CURRENT_TIMESTAMP)
+		AND u.disabled_at IS NULL
+	`
+	err := db.QueryRow(query, tokenHash).Scan(
+		&pat.PersonalAccessTokenId,
+		&pat.BankingUserId,
+		&pat.Name,
+		&pat.TokenHash,
+		&pat.TokenPrefix,
+		pq.Array(&pat.Scopes),
+		&pat.ExpiresAt,
+		&pat.LastUsedAt,
+		&pat.RevokedAt,
+		&pat.DateCreated,
+	)
+	if err != nil {
+		return pat, err
+	}
+	return pat, nil
+}
+
+// GetPersonalAccessTokensByUserId lists the user's tokens that have not been revoked
+func GetPersonalAccessTokensByUserId(userID int, db *sql.DB) ([]PersonalAccessToken, error) {
+	var pats []PersonalAccessToken
+	query := `
+		SELECT personal_access_token_id, banking_user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, date_created
+		FROM personal_access_token
+		WHERE banking_user_id = $1 AND revoked_at IS NULL
+		ORDER BY date_created DESC
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pat PersonalAccessToken
+		if err := rows.Scan(
+			&pat.PersonalAccessTokenId,
+			&pat.BankingUserId,
+			&pat.Name,
+			&pat.TokenHash,
+			&pat.TokenPrefix,
+			pq.Array(&pat.Scopes),
+			&pat.ExpiresAt,
+			&pat.LastUsedAt,
+			&pat.RevokedAt,
+			&pat.DateCreated,
+		); err != nil {
+			return pats, err
+		}
+		pats = append(pats, pat)
+	}
+
+	return pats, rows.Err()
+}
+
+// RevokePersonalAccessTokenAuthorized revokes a token only if it belongs to the authenticated user
+func RevokePersonalAccessTokenAuthorized(patID int, authenticatedUserID int, db *sql.DB) (PersonalAccessToken, error) {
+	var pat PersonalAccessToken
+	query := `
+		UPDATE personal_access_token
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE personal_access_token_id = $1 AND banking_user_id = $2 AND revoked_at IS NULL
+		RETURNING personal_access_token_id, banking_user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, date_created
+	`
+	err := db.QueryRow(query, patID, authenticatedUserID).Scan(
+		&pat.PersonalAccessTokenId,
+		&pat.BankingUserId,
+		&pat.Name,
+		&pat.TokenHash,
+		&pat.TokenPrefix,
+		pq.Array(&pat.Scopes),
+		&pat.ExpiresAt,
+		&pat.LastUsedAt,
+		&pat.RevokedAt,
+		&pat.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return pat, err
+	}
+	return pat, nil
+}
+
+// revokeAllPersonalAccessTokens revokes every active token belonging to a user
+func revokeAllPersonalAccessTokens(q querier, userID int) (int64, error) {
+	query := `
+		UPDATE personal_access_token
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $1 AND revoked_at IS NULL
+	`
+	result, err := q.Exec(query, userID)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// TouchPersonalAccessToken records use of a token, at most once a minute
+func TouchPersonalAccessToken(patID int, db *sql.DB) error {
+	query := `
+		UPDATE personal_access_token
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE personal_access_token_id = $1
+		AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`
+	_, err := db.Exec(query, patID)
+	return err
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+	"time"
+)
+
+type AuthSession = models.AuthSession
+
+// CreateSession opens a new session for the user, valid for ttl unless it is rotated or revoked
+func CreateSession(userID int, refreshTokenHash string, userAgent string, ipAddress string, ttl time.Duration, db *sql.DB) (AuthSession, error) {
+	var session AuthSession
+	query := `
+		INSERT INTO auth_session (banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, date_created, date_updated)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + make_interval(secs => $5), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING auth_session_id, banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, revoked_at, date_created, date_updated
+	`
+	err := db.QueryRow(query, userID, refreshTokenHash, userAgent, ipAddress, ttl.Seconds()).Scan(
+		&session.AuthSessionId,
+		&session.BankingUserId,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IpAddress,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.DateCreated,
+		&session.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return session, err
+	}
+	return session, nil
+}
+
+// GetActiveSession returns the session only if it has not been revoked or expired
+func GetActiveSession(sessionID int, db *sql.DB) (AuthSession, error) {
+	var session AuthSession
+	query := `
+		SELECT auth_session_id, banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, revoked_at, date_created, date_updated
+		FROM auth_session
+		WHERE auth_session_id = $1
+		AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+	`
+	err := db.QueryRow(query, sessionID).Scan(
+		&session.AuthSessionId,
+		&session.BankingUserId,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IpAddress,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.DateCreated,
+		&session.DateUpdated,
+	)
+	if err != nil {
+		return session, err
+	}
+	return session, nil
+}
+
+// RotateSession swaps the session's refresh token for a new one and extends its expiry.
+// Presenting a refresh token that was already rotated out revokes the whole session,
+// since that means the token was copied and is being replayed.
+func RotateSession(refreshTokenHash string, newRefreshTokenHash string, userAgent string, ipAddress string, ttl time.Duration, db *sql.DB) (AuthSession, error) {
+	var session AuthSession
+	query := `
+		UPDATE auth_session
+		SET previous_refresh_token_hash = refresh_token_hash,
+		    refresh_token_hash = $2,
+		    user_agent = $3,
+		    ip_address = $4,
+		    last_used_at = CURRENT_TIMESTAMP,
+		    expires_at = CURRENT_TIMESTAMP + make_interval(secs => $5),
+		    date_updated = CURRENT_TIMESTAMP
+		WHERE refresh_token_hash = $1
+		AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+		RETURNING auth_session_id, banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, revoked_at, date_created, date_updated
+	`
+	err := db.QueryRow(query, refreshTokenHash, newRefreshTokenHash, userAgent, ipAddress, ttl.Seconds()).Scan(
+		&session.AuthSessionId,
+		&session.BankingUserId,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IpAddress,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.DateCreated,
+		&session.DateUpdated,
+	)
+	if err == sql.ErrNoRows {
+		reuseQuery := `
+			UPDATE auth_session
+			SET revoked_at = CURRENT_TIMESTAMP, date_updated = CURRENT_TIMESTAMP
+			WHERE previous_refresh_token_hash = $1 AND revoked_at IS NULL
+		`
+		if _, reuseErr := db.Exec(reuseQuery, refreshTokenHash); reuseErr != nil {
+			log.Print(reuseErr)
+		}
+		return session, err
+	}
+	if err != nil {
+		log.Print(err)
+		return session, err
+	}
+	return session, nil
+}
+
+// RevokeSessionAuthorized revokes a session only if it belongs to the authenticated user
+func RevokeSessionAuthorized(sessionID int, authenticatedUserID int, db *sql.DB) (AuthSession, error) {
+	var session AuthSession
+	query := `
+		UPDATE auth_session
+		SET revoked_at = CURRENT_TIMESTAMP, date_updated = CURRENT_TIMESTAMP
+		WHERE auth_session_id = $1 AND banking_user_id = $2 AND revoked_at IS NULL
+		RETURNING auth_session_id, banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, revoked_at, date_created, date_updated
+	`
+	err := db.QueryRow(query, sessionID, authenticatedUserID).Scan(
+		&session.AuthSessionId,
+		&session.BankingUserId,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&session.IpAddress,
+		&session.LastUsedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.DateCreated,
+		&session.DateUpdated,
+	)
+	if err != nil {
+		log.Print(err)
+		return session, err
+	}
+	return session, nil
+}
+
+// GetActiveSessionsByUserId lists the user's sessions that can still be used, most recently used first
+func GetActiveSessionsByUserId(userID int, db *sql.DB) ([]AuthSession, error) {
+	var sessions []AuthSession
+	query := `
+		SELECT auth_session_id, banking_user_id, refresh_token_hash, user_agent, ip_address, last_used_at, expires_at, revoked_at, date_created, date_updated
+		FROM auth_session
+		WHERE banking_user_id = $1
+		AND revoked_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session AuthSession
+		if err := rows.Scan(
+			&session.AuthSessionId,
+			&session.BankingUserId,
+			&session.RefreshTokenHash,
+			&session.UserAgent,
+			&session.IpAddress,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+			&session.DateCreated,
+			&session.DateUpdated,
+		); err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records that the session was just used. Writes are limited to once a minute
+// so that busy clients don't turn every read request into an UPDATE.
+func TouchSession(sessionID int, ipAddress string, db *sql.DB) error {
+	query := `
+		UPDATE auth_session
+		SET last_used_at = CURRENT_TIMESTAMP, ip_address = $2
+		WHERE auth_session_id = $1
+		AND last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+	`
+	_, err := db.Exec(query, sessionID, ipAddress)
+	return err
+}
+
+// RevokeAllSessionsAuthorized revokes every active session belonging to the authenticated user
+func RevokeAllSessionsAuthorized(authenticatedUserID int, db *sql.DB) (int64, error) {
+	return revokeAllSessions(db, authenticatedUserID)
+}
+
+func revokeAllSessions(q querier, userID int) (int64, error) {
+	query := `
+		UPDATE auth_session
+		SET revoked_at = CURRENT_TIMESTAMP, date_updated = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $1 AND revoked_at IS NULL
+	`
+	result, err := q.Exec(query, userID)
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
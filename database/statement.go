@@ -10,13 +10,17 @@ import (
 type Statement = models.Statement
 
 func CreateStatement(statement Statement, db *sql.DB) (Statement, error) {
+	return createStatement(db, statement)
+}
+
+func createStatement(q querier, statement Statement) (Statement, error) {
 	log.Print("creating statement...")
 	query := `
 		INSERT INTO statement (banking_user_id, institution_id, period_start, period_end, date_added)
 		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
 		RETURNING statement_id, banking_user_id, institution_id, period_start, period_end, date_added
 		`
-	err := db.QueryRow(query,
+	err := q.QueryRow(query,
 		statement.BankingUserId,
 		statement.InstitutionId,
 		statement.PeriodStart,
@@ -44,6 +48,45 @@ func CreateStatementAuthorized(statement Statement, authenticatedUserID int, db
 	return CreateStatement(statement, db)
 }
 
+// matchOrCreateStatement returns the authenticated user's statement for the same institution
+// and period, creating it when an import is the first to cover that period
+func matchOrCreateStatement(q querier, statement Statement, authenticatedUserID int) (Statement, error) {
+	statement.BankingUserId = authenticatedUserID
+	var match Statement
+	query := `
+		SELECT statement_id, banking_user_id, institution_id, period_start, period_end, date_added
+		FROM statement
+		WHERE banking_user_id = $1
+		AND institution_id = $2
+		AND period_start::DATE = ($3)::DATE
+		AND period_end::DATE = ($4)::DATE
+		ORDER BY statement_id
+		LIMIT 1
+		`
+	err := q.QueryRow(query,
+		statement.BankingUserId,
+		statement.InstitutionId,
+		statement.PeriodStart,
+		statement.PeriodEnd,
+	).Scan(
+		&match.StatementId,
+		&match.BankingUserId,
+		&match.InstitutionId,
+		&match.PeriodStart,
+		&match.PeriodEnd,
+		&match.DateAdded,
+	)
+	if err == sql.ErrNoRows {
+		return createStatement(q, statement)
+	}
+	if err != nil {
+		log.Print(err)
+		return statement, err
+	}
+
+	return match, nil
+}
+
 func GetStatement(statementId int, db *sql.DB) (Statement, error) {
 	var statement Statement
 	log.Print("statement id is " + strconv.Itoa(statementId))
@@ -5,16 +5,15 @@ import (
 	"fmt"
 	"log"
 	"moneyd/api/models"
-	"strings"
 )
 
 type Transaction = models.Transaction
 
 func CreateTransaction(txn Transaction, db *sql.DB) (Transaction, error) {
 	query := `
-		INSERT INTO transaction (statement_id, transaction_type_lookup_code, description, amount, transaction_date, date_added, date_updated)
-		VALUES ($1, $2, $3, ($4)::NUMERIC(14,2) / 100, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING transaction_id, statement_id, description, transaction_date, date_added, date_updated
+		INSERT INTO transaction (statement_id, transaction_type_lookup_code, description, amount, transaction_date, external_id, value_date, counterparty_name, counterparty_account, date_added, date_updated)
+		VALUES ($1, $2, $3, ($4)::NUMERIC(14,2) / 100, $5, NULLIF($6, ''), $7, NULLIF($8, ''), NULLIF($9, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING transaction_id, statement_id, description, transaction_date, date_added, date_updated, COALESCE(external_id, ''), value_date, COALESCE(counterparty_name, ''), COALESCE(counterparty_account, '')
 	`
 	err := db.QueryRow(
 		query,
@@ -23,6 +22,10 @@ func CreateTransaction(txn Transaction, db *sql.DB) (Transaction, error) {
 		txn.Description,
 		txn.Amount,
 		txn.TransactionDate,
+		txn.ExternalId,
+		txn.ValueDate,
+		txn.CounterpartyName,
+		txn.CounterpartyAccount,
 	).Scan(
 		&txn.TransactionId,
 		&txn.StatementId,
@@ -30,6 +33,10 @@ func CreateTransaction(txn Transaction, db *sql.DB) (Transaction, error) {
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 
 	if err != nil {
@@ -56,87 +63,10 @@ func CreateTransactionAuthorized(txn Transaction, authenticatedUserID int, db *s
 	return CreateTransaction(txn, db)
 }
 
-func CreateTransactionsBatch(txns []Transaction, db *sql.DB) ([]Transaction, error) {
-	txnCols := 4
-	var sb strings.Builder
-	args := make([]interface{}, 0, len(txns)*txnCols)
-
-	placeholder := 1
-	sb.WriteString("INSERT INTO transaction (statement_id, transaction_type_lookup_code, description, amount, transaction_date, date_added, date_updated)")
-	sb.WriteString("VALUES ")
-
-	for index, txn := range txns {
-		sb.WriteString("(")
-		sb.WriteString(fmt.Sprintf("$%d, $%d, $%d, ($%d)::NUMERIC(14,2) / 100, $%d, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP", placeholder, placeholder+1, placeholder+2, placeholder+3, placeholder+4))
-		sb.WriteString(")")
-
-		if index < len(txns)-1 {
-			sb.WriteString(",")
-		}
-		args = append(args, txn.StatementId, txn.TransactionTypeLookupCode, txn.Description, txn.Amount, txn.TransactionDate)
-		placeholder += 5
-
-	}
-	sb.WriteString(" RETURNING transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated")
-
-	query := sb.String()
-
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var inserted []Transaction
-	for rows.Next() {
-		var t Transaction
-		if err := rows.Scan(
-			&t.TransactionId,
-			&t.StatementId,
-			&t.Description,
-			&t.Amount,
-			&t.TransactionDate,
-			&t.DateAdded,
-			&t.DateUpdated,
-		); err != nil {
-			return nil, err
-		}
-		inserted = append(inserted, t)
-	}
-
-	return inserted, rows.Err()
-
-}
-
-// CreateTransactionsBatchAuthorized creates multiple transactions only if all statements belong to the authenticated user
-func CreateTransactionsBatchAuthorized(txns []Transaction, authenticatedUserID int, db *sql.DB) ([]Transaction, error) {
-	// Collect unique statement IDs
-	statementIds := make(map[int]bool)
-	for _, txn := range txns {
-		statementIds[txn.StatementId] = true
-	}
-
-	// Verify all statements belong to the user
-	for stmtId := range statementIds {
-		var count int
-		verifyQuery := `SELECT COUNT(*) FROM statement WHERE statement_id = $1 AND banking_user_id = $2`
-		err := db.QueryRow(verifyQuery, stmtId, authenticatedUserID).Scan(&count)
-		if err != nil {
-			log.Print(err)
-			return nil, err
-		}
-		if count == 0 {
-			return nil, fmt.Errorf("statement %d not found or access denied", stmtId)
-		}
-	}
-
-	return CreateTransactionsBatch(txns, db)
-}
-
 func GetTransaction(transactionId int, db *sql.DB) (Transaction, error) {
 	var txn Transaction
 	query := `
-	SELECT transaction_id, transaction_type_lookup_code, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated
+	SELECT transaction_id, transaction_type_lookup_code, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated, COALESCE(external_id, ''), value_date, COALESCE(counterparty_name, ''), COALESCE(counterparty_account, '')
 		FROM transaction
 		WHERE transaction_id = $1
 	`
@@ -149,6 +79,10 @@ func GetTransaction(transactionId int, db *sql.DB) (Transaction, error) {
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 	if err != nil {
 		log.Print(err)
@@ -161,7 +95,7 @@ func GetTransaction(transactionId int, db *sql.DB) (Transaction, error) {
 func GetTransactionAuthorized(transactionId int, authenticatedUserID int, db *sql.DB) (Transaction, error) {
 	var txn Transaction
 	query := `
-	SELECT t.transaction_id, t.transaction_type_lookup_code, t.statement_id, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
+	SELECT t.transaction_id, t.transaction_type_lookup_code, t.statement_id, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
 		FROM transaction t
 		JOIN statement s ON s.statement_id = t.statement_id
 		WHERE t.transaction_id = $1 AND s.banking_user_id = $2
@@ -175,6 +109,10 @@ func GetTransactionAuthorized(transactionId int, authenticatedUserID int, db *sq
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 	if err != nil {
 		log.Print(err)
@@ -186,7 +124,7 @@ func GetTransactionAuthorized(transactionId int, authenticatedUserID int, db *sq
 func GetTransactionsByStatementId(statementId int, db *sql.DB) ([]Transaction, error) {
 	var txns []Transaction
 	query := `
-	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
 		FROM transaction t
 		JOIN statement s on s.statement_id = t.statement_id
 		WHERE s.statement_id = $1;
@@ -212,6 +150,10 @@ func GetTransactionsByStatementId(statementId int, db *sql.DB) ([]Transaction, e
 			&txn.TransactionDate,
 			&txn.DateAdded,
 			&txn.DateUpdated,
+			&txn.ExternalId,
+			&txn.ValueDate,
+			&txn.CounterpartyName,
+			&txn.CounterpartyAccount,
 		); err != nil {
 			return txns, err
 		}
@@ -229,7 +171,7 @@ func GetTransactionsByStatementId(statementId int, db *sql.DB) ([]Transaction, e
 func GetTransactionsByStatementIdAuthorized(statementId int, authenticatedUserID int, db *sql.DB) ([]Transaction, error) {
 	var txns []Transaction
 	query := `
-	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
 		FROM transaction t
 		JOIN statement s on s.statement_id = t.statement_id
 		WHERE s.statement_id = $1 AND s.banking_user_id = $2;
@@ -256,6 +198,10 @@ func GetTransactionsByStatementIdAuthorized(statementId int, authenticatedUserID
 			&txn.TransactionDate,
 			&txn.DateAdded,
 			&txn.DateUpdated,
+			&txn.ExternalId,
+			&txn.ValueDate,
+			&txn.CounterpartyName,
+			&txn.CounterpartyAccount,
 		); err != nil {
 			return txns, err
 		}
@@ -269,56 +215,6 @@ func GetTransactionsByStatementIdAuthorized(statementId int, authenticatedUserID
 	return txns, nil
 }
 
-func GetTransactionsByUserId(userId int, db *sql.DB) ([]Transaction, error) {
-	var txns []Transaction
-	query := `
-	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
-		FROM transaction t
-		JOIN statement s on s.statement_id = t.statement_id
-		WHERE s.banking_user_id = $1;
-		`
-
-	rows, err := db.Query(
-		query,
-		userId,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var txn Transaction
-		if err := rows.Scan(
-			&txn.TransactionId,
-			&txn.StatementId,
-			&txn.TransactionTypeLookupCode,
-			&txn.Description,
-			&txn.Amount,
-			&txn.TransactionDate,
-			&txn.DateAdded,
-			&txn.DateUpdated,
-		); err != nil {
-			return txns, err
-		}
-		txns = append(txns, txn)
-	}
-
-	if err = rows.Err(); err != nil {
-		return txns, nil
-	}
-
-	return txns, nil
-}
-
-// GetTransactionsByUserIdAuthorized retrieves transactions only for the authenticated user
-func GetTransactionsByUserIdAuthorized(userId int, authenticatedUserID int, db *sql.DB) ([]Transaction, error) {
-	if userId != authenticatedUserID {
-		return []Transaction{}, nil
-	}
-	return GetTransactionsByUserId(userId, db)
-}
-
 func UpdateTransaction(txnId int, txn Transaction, db *sql.DB) (Transaction, error) {
 	query := `
 		UPDATE transaction
@@ -328,7 +224,7 @@ func UpdateTransaction(txnId int, txn Transaction, db *sql.DB) (Transaction, err
 		    transaction_date = $4,
 		    date_updated = CURRENT_TIMESTAMP
 		WHERE transaction_id = $5
-		RETURNING transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated
+		RETURNING transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated, COALESCE(external_id, ''), value_date, COALESCE(counterparty_name, ''), COALESCE(counterparty_account, '')
 	`
 	err := db.QueryRow(
 		query,
@@ -345,6 +241,10 @@ func UpdateTransaction(txnId int, txn Transaction, db *sql.DB) (Transaction, err
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 	if err != nil {
 		log.Print(err)
@@ -390,7 +290,7 @@ func DeleteTransaction(transactionId int, db *sql.DB) (Transaction, error) {
 	query := `
 		DELETE FROM transaction
 		WHERE transaction_id = $1
-		RETURNING transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated
+		RETURNING transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated, COALESCE(external_id, ''), value_date, COALESCE(counterparty_name, ''), COALESCE(counterparty_account, '')
 	`
 	var txn Transaction
 	err := db.QueryRow(query, transactionId).Scan(
@@ -401,6 +301,10 @@ func DeleteTransaction(transactionId int, db *sql.DB) (Transaction, error) {
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 	if err != nil {
 		log.Print(err)
@@ -417,7 +321,7 @@ func DeleteTransactionAuthorized(transactionId int, authenticatedUserID int, db
 		WHERE t.transaction_id = $1
 		AND t.statement_id = s.statement_id
 		AND s.banking_user_id = $2
-		RETURNING t.transaction_id, t.statement_id, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
+		RETURNING t.transaction_id, t.statement_id, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
 	`
 	var txn Transaction
 	err := db.QueryRow(query, transactionId, authenticatedUserID).Scan(
@@ -428,6 +332,10 @@ func DeleteTransactionAuthorized(transactionId int, authenticatedUserID int, db
 		&txn.TransactionDate,
 		&txn.DateAdded,
 		&txn.DateUpdated,
+		&txn.ExternalId,
+		&txn.ValueDate,
+		&txn.CounterpartyName,
+		&txn.CounterpartyAccount,
 	)
 	if err != nil {
 		log.Print(err)
@@ -441,7 +349,7 @@ func GetTransactionsByInstitutionId(db *sql.DB, args []int) ([]Transaction, erro
 	institutionId := args[1]
 	var txns []Transaction
 	query := `
-	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
 		FROM transaction t
 		JOIN statement s on s.statement_id = t.statement_id
 		WHERE s.banking_user_id = $1
@@ -468,6 +376,10 @@ func GetTransactionsByInstitutionId(db *sql.DB, args []int) ([]Transaction, erro
 			&txn.TransactionDate,
 			&txn.DateAdded,
 			&txn.DateUpdated,
+			&txn.ExternalId,
+			&txn.ValueDate,
+			&txn.CounterpartyName,
+			&txn.CounterpartyAccount,
 		); err != nil {
 			return txns, err
 		}
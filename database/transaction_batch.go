@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"moneyd/api/models"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type TransactionBatchChunk = models.TransactionBatchChunk
+
+const (
+	// transactionInsertChunkSize rows go into each multi-row INSERT, at 9 bind parameters a row
+	// well clear of Postgres's 65535 parameter limit
+	transactionInsertChunkSize = 1000
+	// Batches of at least transactionCopyThreshold rows are streamed into a staging table with
+	// COPY FROM and moved into transaction transactionCopyChunkSize rows at a time
+	transactionCopyThreshold = 5000
+	transactionCopyChunkSize = 10000
+)
+
+const insertedTransactionColumns = `transaction_id, statement_id, description, (amount * 100)::INTEGER, transaction_date, date_added, date_updated, COALESCE(external_id, ''), value_date, COALESCE(counterparty_name, ''), COALESCE(counterparty_account, '')`
+
+// InsertTransactionsTx inserts transactions in order as part of tx, in chunks that stay under
+// Postgres's bind parameter limit. progress, if not nil, is called after each chunk. Nothing is
+// visible to other connections until the caller commits tx.
+func InsertTransactionsTx(tx *sql.Tx, txns []Transaction, progress func(TransactionBatchChunk)) ([]Transaction, error) {
+	inserted := make([]Transaction, 0, len(txns))
+	if len(txns) == 0 {
+		return inserted, nil
+	}
+
+	chunkSize := transactionInsertChunkSize
+	insertChunk := insertTransactionChunk
+	if len(txns) >= transactionCopyThreshold {
+		if err := createTransactionStaging(tx); err != nil {
+			return nil, err
+		}
+		chunkSize = transactionCopyChunkSize
+		insertChunk = copyTransactionChunk
+	}
+
+	for chunk, start := 1, 0; start < len(txns); chunk, start = chunk+1, start+chunkSize {
+		end := min(start+chunkSize, len(txns))
+		created, err := insertChunk(tx, txns[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("rows %d-%d: %w", start+1, end, err)
+		}
+		inserted = append(inserted, created...)
+
+		if progress != nil {
+			progress(TransactionBatchChunk{Chunk: chunk, Rows: len(created), Inserted: len(inserted)})
+		}
+	}
+
+	return inserted, nil
+}
+
+func insertTransactionChunk(tx *sql.Tx, txns []Transaction) ([]Transaction, error) {
+	txnCols := 9
+	var sb strings.Builder
+	args := make([]interface{}, 0, len(txns)*txnCols)
+
+	placeholder := 1
+	sb.WriteString("INSERT INTO transaction (statement_id, transaction_type_lookup_code, description, amount, transaction_date, external_id, value_date, counterparty_name, counterparty_account, date_added, date_updated)")
+	sb.WriteString("VALUES ")
+
+	for index, txn := range txns {
+		sb.WriteString("(")
+		sb.WriteString(fmt.Sprintf("$%d, $%d, $%d, ($%d)::NUMERIC(14,2) / 100, $%d, NULLIF($%d, ''), $%d, NULLIF($%d, ''), NULLIF($%d, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP", placeholder, placeholder+1, placeholder+2, placeholder+3, placeholder+4, placeholder+5, placeholder+6, placeholder+7, placeholder+8))
+		sb.WriteString(")")
+
+		if index < len(txns)-1 {
+			sb.WriteString(",")
+		}
+		args = append(args, txn.StatementId, txn.TransactionTypeLookupCode, txn.Description, txn.Amount, txn.TransactionDate, txn.ExternalId, txn.ValueDate, txn.CounterpartyName, txn.CounterpartyAccount)
+		placeholder += txnCols
+	}
+	sb.WriteString(" RETURNING " + insertedTransactionColumns)
+
+	rows, err := tx.Query(sb.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanInsertedTransactions(rows)
+}
+
+// createTransactionStaging creates the session's COPY target. It is dropped when tx ends, and
+// emptied here in case an earlier batch in the same transaction already used it.
+func createTransactionStaging(tx *sql.Tx) error {
+	query := `
+		CREATE TEMP TABLE IF NOT EXISTS transaction_staging (
+			ordinal INTEGER NOT NULL,
+			statement_id INTEGER NOT NULL,
+			transaction_type_lookup_code INTEGER NOT NULL,
+			description TEXT NOT NULL,
+			amount BIGINT NOT NULL,
+			transaction_date TIMESTAMP NOT NULL,
+			external_id TEXT,
+			value_date DATE,
+			counterparty_name TEXT,
+			counterparty_account TEXT
+		) ON COMMIT DROP
+	`
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`TRUNCATE transaction_staging`)
+	return err
+}
+
+// copyTransactionChunk streams a chunk into transaction_staging with COPY FROM, then moves it into
+// transaction with a single INSERT ... SELECT so the fingerprint trigger and RETURNING still apply
+func copyTransactionChunk(tx *sql.Tx, txns []Transaction) ([]Transaction, error) {
+	stmt, err := tx.Prepare(pq.CopyIn(
+		"transaction_staging",
+		"ordinal",
+		"statement_id",
+		"transaction_type_lookup_code",
+		"description",
+		"amount",
+		"transaction_date",
+		"external_id",
+		"value_date",
+		"counterparty_name",
+		"counterparty_account",
+	))
+	if err != nil {
+		return nil, err
+	}
+	for i, txn := range txns {
+		if _, err := stmt.Exec(
+			i,
+			txn.StatementId,
+			txn.TransactionTypeLookupCode,
+			txn.Description,
+			txn.Amount,
+			txn.TransactionDate,
+			txn.ExternalId,
+			txn.ValueDate,
+			txn.CounterpartyName,
+			txn.CounterpartyAccount,
+		); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH inserted AS (
+			INSERT INTO transaction (statement_id, transaction_type_lookup_code, description, amount, transaction_date, external_id, value_date, counterparty_name, counterparty_account, date_added, date_updated)
+			SELECT statement_id, transaction_type_lookup_code, description, (amount)::NUMERIC(14,2) / 100, transaction_date, NULLIF(external_id, ''), value_date, NULLIF(counterparty_name, ''), NULLIF(counterparty_account, ''), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+			FROM transaction_staging
+			ORDER BY ordinal
+			RETURNING ` + insertedTransactionColumns + `
+		)
+		SELECT * FROM inserted ORDER BY transaction_id
+	`
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanInsertedTransactions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`TRUNCATE transaction_staging`); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func scanInsertedTransactions(rows *sql.Rows) ([]Transaction, error) {
+	defer rows.Close()
+
+	var inserted []Transaction
+	for rows.Next() {
+		var t Transaction
+		if err := rows.Scan(
+			&t.TransactionId,
+			&t.StatementId,
+			&t.Description,
+			&t.Amount,
+			&t.TransactionDate,
+			&t.DateAdded,
+			&t.DateUpdated,
+			&t.ExternalId,
+			&t.ValueDate,
+			&t.CounterpartyName,
+			&t.CounterpartyAccount,
+		); err != nil {
+			log.Print(err)
+			return nil, err
+		}
+		inserted = append(inserted, t)
+	}
+
+	return inserted, rows.Err()
+}
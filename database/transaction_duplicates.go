@@ -0,0 +1,349 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"moneyd/api/models"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type TransactionBatchResult = models.TransactionBatchResult
+
+// DuplicateTransactionsError rejects a batch under the fail policy, listing every duplicate row
+type DuplicateTransactionsError struct {
+	Rows []models.DuplicateRow
+}
+
+func (e *DuplicateTransactionsError) Error() string {
+	return fmt.Sprintf("%d rows duplicate existing transactions", len(e.Rows))
+}
+
+// ErrStatementNotFound rejects a batch that refers to a statement the authenticated user does
+// not own, or that does not exist
+var ErrStatementNotFound = errors.New("statement not found or access denied")
+
+// FindLikelyDuplicatesAuthorized matches candidates against the authenticated user's existing
+// transactions by fingerprint (see transaction_fingerprint in the migrations). institutionIds runs
+// parallel to txns. A fingerprint that already exists n times only marks its first n candidates,
+// so a statement that legitimately repeats a transaction keeps the extra copies. The result maps
+// a candidate's index to the existing transaction_id it repeats.
+func FindLikelyDuplicatesAuthorized(txns []Transaction, institutionIds []int, authenticatedUserID int, db *sql.DB) (map[int]int, error) {
+	return findLikelyDuplicates(db, txns, institutionIds, authenticatedUserID)
+}
+
+func findLikelyDuplicates(q querier, txns []Transaction, institutionIds []int, authenticatedUserID int) (map[int]int, error) {
+	duplicates := make(map[int]int)
+	if len(txns) == 0 {
+		return duplicates, nil
+	}
+
+	indexes := make([]int64, len(txns))
+	institutions := make([]int64, len(txns))
+	dates := make([]string, len(txns))
+	amounts := make([]int64, len(txns))
+	descriptions := make([]string, len(txns))
+	externalIds := make([]string, len(txns))
+	for i, txn := range txns {
+		indexes[i] = int64(i)
+		institutions[i] = int64(institutionIds[i])
+		dates[i] = txn.TransactionDate.Format("2006-01-02")
+		amounts[i] = txn.Amount
+		descriptions[i] = txn.Description
+		externalIds[i] = txn.ExternalId
+	}
+
+	query := `
+		WITH candidate AS (
+			SELECT c.idx, transaction_fingerprint(c.institution_id, c.external_id, c.transaction_date, c.amount, c.description) AS fingerprint
+			FROM unnest($2::INTEGER[], $3::INTEGER[], $4::DATE[], $5::BIGINT[], $6::TEXT[], $7::TEXT[])
+				AS c(idx, institution_id, transaction_date, amount, description, external_id)
+		),
+		existing AS (
+			SELECT t.fingerprint, COUNT(*) AS copies, MIN(t.transaction_id) AS transaction_id
+			FROM transaction t
+			JOIN statement s ON s.statement_id = t.statement_id
+			WHERE s.banking_user_id = $1
+			AND t.fingerprint IN (SELECT fingerprint FROM candidate)
+			GROUP BY t.fingerprint
+		)
+		SELECT c.idx, c.fingerprint, e.copies, e.transaction_id
+		FROM candidate c
+		JOIN existing e ON e.fingerprint = c.fingerprint
+		ORDER BY c.idx
+	`
+	rows, err := q.Query(
+		query,
+		authenticatedUserID,
+		pq.Array(indexes),
+		pq.Array(institutions),
+		pq.Array(dates),
+		pq.Array(amounts),
+		pq.Array(descriptions),
+		pq.Array(externalIds),
+	)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]int)
+	for rows.Next() {
+		var index, copies, transactionId int
+		var fingerprint string
+		if err := rows.Scan(&index, &fingerprint, &copies, &transactionId); err != nil {
+			return duplicates, err
+		}
+		seen[fingerprint]++
+		if seen[fingerprint] <= copies {
+			duplicates[index] = transactionId
+		}
+	}
+
+	return duplicates, rows.Err()
+}
+
+// GetStatementInstitutionsAuthorized maps each statement the transactions refer to onto its
+// institution, failing if any statement does not belong to the authenticated user
+func GetStatementInstitutionsAuthorized(txns []Transaction, authenticatedUserID int, db *sql.DB) (map[int]int, error) {
+	return statementInstitutions(db, txns, authenticatedUserID, "")
+}
+
+// lockStatementInstitutions is GetStatementInstitutionsAuthorized inside tx, holding a share lock
+// on the statements so they cannot be deleted or reassigned before tx commits
+func lockStatementInstitutions(tx *sql.Tx, txns []Transaction, authenticatedUserID int) (map[int]int, error) {
+	return statementInstitutions(tx, txns, authenticatedUserID, "FOR SHARE")
+}
+
+func statementInstitutions(q querier, txns []Transaction, authenticatedUserID int, lock string) (map[int]int, error) {
+	var statementIds []int64
+	for _, txn := range txns {
+		statementIds = append(statementIds, int64(txn.StatementId))
+	}
+
+	query := `
+		SELECT statement_id, institution_id
+		FROM statement
+		WHERE banking_user_id = $1 AND statement_id = ANY($2)
+	` + lock
+	rows, err := q.Query(query, authenticatedUserID, pq.Array(statementIds))
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	institutions := make(map[int]int)
+	for rows.Next() {
+		var statementId, institutionId int
+		if err := rows.Scan(&statementId, &institutionId); err != nil {
+			return nil, err
+		}
+		institutions[statementId] = institutionId
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, txn := range txns {
+		if _, ok := institutions[txn.StatementId]; !ok {
+			return nil, fmt.Errorf("%w: statement %d", ErrStatementNotFound, txn.StatementId)
+		}
+	}
+	return institutions, nil
+}
+
+// CreateTransactionsBatchWithPolicyAuthorized inserts a batch after checking it for transactions
+// the user already has. policy decides what happens to them: skip leaves them out, flag inserts
+// them and reports them, fail inserts nothing and returns a *DuplicateTransactionsError. The
+// checks and the insert run in one database transaction; any error leaves nothing inserted.
+func CreateTransactionsBatchWithPolicyAuthorized(txns []Transaction, policy string, authenticatedUserID int, db *sql.DB) (TransactionBatchResult, error) {
+	if err := validateDuplicatePolicy(policy); err != nil {
+		return newTransactionBatchResult(), err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Print(err)
+		return newTransactionBatchResult(), err
+	}
+	defer tx.Rollback()
+
+	result, err := insertTransactionsWithPolicy(tx, txns, policy, authenticatedUserID)
+	if err != nil {
+		return result, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		return result, err
+	}
+	return result, nil
+}
+
+// ImportTransactionsAuthorized inserts the rows of an import as
+// CreateTransactionsBatchWithPolicyAuthorized does, in the same database transaction as the
+// statement they go into and the CSV column mapping the import asked to keep. A statement without
+// an ID is matched or created first and updated in place, and every row is given its ID; a nil
+// statement keeps the rows' own statement IDs. A non-nil mapping is saved for its InstitutionId
+// once the rows are in. Any error leaves nothing behind, including a statement created for the
+// import.
+func ImportTransactionsAuthorized(statement *Statement, txns []Transaction, mapping *CsvColumnMapping, policy string, authenticatedUserID int, db *sql.DB) (TransactionBatchResult, error) {
+	if err := validateDuplicatePolicy(policy); err != nil {
+		return newTransactionBatchResult(), err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Print(err)
+		return newTransactionBatchResult(), err
+	}
+	defer tx.Rollback()
+
+	if statement != nil {
+		if statement.StatementId == 0 {
+			matched, err := matchOrCreateStatement(tx, *statement, authenticatedUserID)
+			if err != nil {
+				return newTransactionBatchResult(), err
+			}
+			*statement = matched
+		}
+		for i := range txns {
+			txns[i].StatementId = statement.StatementId
+		}
+	}
+
+	result, err := insertTransactionsWithPolicy(tx, txns, policy, authenticatedUserID)
+	if err != nil {
+		return result, err
+	}
+	if mapping != nil {
+		if _, err := saveCsvColumnMapping(tx, mapping.InstitutionId, *mapping, authenticatedUserID); err != nil {
+			return result, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		return result, err
+	}
+	return result, nil
+}
+
+// CreateTransactionsStreamAuthorized inserts the chunks returned by next, until it returns io.EOF,
+// in a single database transaction, applying policy to each chunk as
+// CreateTransactionsBatchWithPolicyAuthorized does. report receives each chunk's result before
+// the next chunk is read; row numbers in it are positions within that chunk. Under the fail
+// policy the first chunk with duplicates ends the stream with a *DuplicateTransactionsError.
+// Any error, including one from next, rolls back every chunk.
+func CreateTransactionsStreamAuthorized(next func() ([]Transaction, error), report func(TransactionBatchResult), policy string, authenticatedUserID int, db *sql.DB) error {
+	if err := validateDuplicatePolicy(policy); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for {
+		txns, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err := insertTransactionsWithPolicy(tx, txns, policy, authenticatedUserID)
+		if err != nil {
+			return err
+		}
+		report(result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+func validateDuplicatePolicy(policy string) error {
+	if !slices.Contains(models.DuplicatePolicies, policy) {
+		return fmt.Errorf("unknown duplicate policy %q; use one of %s", policy, strings.Join(models.DuplicatePolicies, ", "))
+	}
+	return nil
+}
+
+func newTransactionBatchResult() TransactionBatchResult {
+	return TransactionBatchResult{
+		Transactions: []Transaction{},
+		Skipped:      []models.DuplicateRow{},
+		Flagged:      []models.DuplicateRow{},
+		Chunks:       []TransactionBatchChunk{},
+	}
+}
+
+// insertTransactionsWithPolicy does the work of CreateTransactionsBatchWithPolicyAuthorized inside tx
+func insertTransactionsWithPolicy(tx *sql.Tx, txns []Transaction, policy string, authenticatedUserID int) (TransactionBatchResult, error) {
+	result := newTransactionBatchResult()
+	if len(txns) == 0 {
+		return result, nil
+	}
+
+	institutions, err := lockStatementInstitutions(tx, txns, authenticatedUserID)
+	if err != nil {
+		return result, err
+	}
+	institutionIds := make([]int, len(txns))
+	for i, txn := range txns {
+		institutionIds[i] = institutions[txn.StatementId]
+	}
+
+	duplicates, err := findLikelyDuplicates(tx, txns, institutionIds, authenticatedUserID)
+	if err != nil {
+		return result, err
+	}
+
+	var insert []Transaction
+	for i, txn := range txns {
+		duplicateOf, isDuplicate := duplicates[i]
+		if !isDuplicate {
+			insert = append(insert, txn)
+			continue
+		}
+
+		row := models.DuplicateRow{Row: i + 1, DuplicateOf: duplicateOf}
+		switch policy {
+		case models.DuplicatePolicyFlag:
+			result.Flagged = append(result.Flagged, row)
+			insert = append(insert, txn)
+		default:
+			result.Skipped = append(result.Skipped, row)
+		}
+	}
+
+	if policy == models.DuplicatePolicyFail && len(result.Skipped) > 0 {
+		return result, &DuplicateTransactionsError{Rows: result.Skipped}
+	}
+	if len(insert) == 0 {
+		return result, nil
+	}
+
+	created, err := InsertTransactionsTx(tx, insert, func(chunk TransactionBatchChunk) {
+		result.Chunks = append(result.Chunks, chunk)
+	})
+	if err != nil {
+		log.Print(err)
+		return result, err
+	}
+	result.Transactions = created
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"moneyd/api/models"
+	"strings"
+	"time"
+)
+
+type TransactionFilter = models.TransactionFilter
+type ExportedTransaction = models.ExportedTransaction
+
+// likePattern escapes LIKE wildcards so a search matches its text literally
+var likePattern = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// transactionFilterClause builds the WHERE clause for a filter over transaction t joined to
+// statement s, starting from the ownership condition on $1
+func transactionFilterClause(filter TransactionFilter, authenticatedUserID int) (string, []any) {
+	conditions := []string{"s.banking_user_id = $1"}
+	args := []any{authenticatedUserID}
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.StatementId != 0 {
+		add("t.statement_id = $%d", filter.StatementId)
+	}
+	if filter.InstitutionId != 0 {
+		add("s.institution_id = $%d", filter.InstitutionId)
+	}
+	if filter.From != nil {
+		add("t.transaction_date::DATE >= $%d::DATE", filter.From.Format("2006-01-02"))
+	}
+	if filter.To != nil {
+		add("t.transaction_date::DATE <= $%d::DATE", filter.To.Format("2006-01-02"))
+	}
+	if filter.TransactionTypeLookupCode != 0 {
+		add("t.transaction_type_lookup_code = $%d", filter.TransactionTypeLookupCode)
+	}
+	if filter.MinAmount != nil {
+		add("t.amount >= ($%d)::NUMERIC(14,2) / 100", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		add("t.amount <= ($%d)::NUMERIC(14,2) / 100", *filter.MaxAmount)
+	}
+	if filter.Search != "" {
+		add("t.description ILIKE '%%' || $%d || '%%'", likePattern.Replace(filter.Search))
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// StreamTransactionsAuthorized calls fn for each of the authenticated user's transactions matching
+// filter, grouped by institution and oldest first, without holding the whole result in memory.
+// It stops at the first error fn returns.
+func StreamTransactionsAuthorized(filter TransactionFilter, fn func(ExportedTransaction) error, authenticatedUserID int, db *sql.DB) error {
+	where, args := transactionFilterClause(filter, authenticatedUserID)
+	query := `
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, ''), s.institution_id, i.name
+		FROM transaction t
+		JOIN statement s on s.statement_id = t.statement_id
+		JOIN institution i on i.institution_id = s.institution_id
+		` + where + `
+		ORDER BY s.institution_id, t.transaction_date, t.transaction_id
+		`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txn ExportedTransaction
+		if err := rows.Scan(
+			&txn.TransactionId,
+			&txn.StatementId,
+			&txn.TransactionTypeLookupCode,
+			&txn.Description,
+			&txn.Amount,
+			&txn.TransactionDate,
+			&txn.DateAdded,
+			&txn.DateUpdated,
+			&txn.ExternalId,
+			&txn.ValueDate,
+			&txn.CounterpartyName,
+			&txn.CounterpartyAccount,
+			&txn.InstitutionId,
+			&txn.InstitutionName,
+		); err != nil {
+			log.Print(err)
+			return err
+		}
+		if err := fn(txn); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetTransactionDateRangeAuthorized returns the earliest and latest transaction_date among the
+// authenticated user's transactions matching filter. Both are zero if nothing matches.
+func GetTransactionDateRangeAuthorized(filter TransactionFilter, authenticatedUserID int, db *sql.DB) (time.Time, time.Time, error) {
+	where, args := transactionFilterClause(filter, authenticatedUserID)
+	query := `
+		SELECT MIN(t.transaction_date), MAX(t.transaction_date)
+		FROM transaction t
+		JOIN statement s on s.statement_id = t.statement_id
+		` + where
+
+	var first, last sql.NullTime
+	if err := db.QueryRow(query, args...).Scan(&first, &last); err != nil {
+		log.Print(err)
+		return time.Time{}, time.Time{}, err
+	}
+	return first.Time, last.Time, nil
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"moneyd/api/models"
+	"time"
+)
+
+type TransactionSort = models.TransactionSort
+type TransactionPage = models.TransactionPage
+
+// ErrInvalidCursor reports a cursor that was not issued for the listing it was passed to
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var transactionSortColumns = map[string]string{
+	models.TransactionSortDate:        "t.transaction_date",
+	models.TransactionSortAmount:      "t.amount",
+	models.TransactionSortDescription: "t.description",
+	models.TransactionSortDateAdded:   "t.date_added",
+}
+
+// transactionCursor is the sort key of the last transaction on a page. Only the field matching
+// Sort is set. It travels to the client as base64-encoded JSON.
+type transactionCursor struct {
+	Sort          string    `json:"sort"`
+	Descending    bool      `json:"descending"`
+	Time          time.Time `json:"time"`
+	Amount        int64     `json:"amount,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	TransactionId int       `json:"transaction_id"`
+}
+
+func newTransactionCursor(sort TransactionSort, txn Transaction) string {
+	cursor := transactionCursor{Sort: sort.Field, Descending: sort.Descending, TransactionId: txn.TransactionId}
+	switch sort.Field {
+	case models.TransactionSortDate:
+		cursor.Time = txn.TransactionDate
+	case models.TransactionSortDateAdded:
+		cursor.Time = txn.DateAdded
+	case models.TransactionSortAmount:
+		cursor.Amount = txn.Amount
+	case models.TransactionSortDescription:
+		cursor.Description = txn.Description
+	}
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func parseTransactionCursor(s string, sort TransactionSort) (transactionCursor, error) {
+	var cursor transactionCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != sort.Field || cursor.Descending != sort.Descending || cursor.TransactionId <= 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// ListTransactionsAuthorized returns up to limit of the authenticated user's transactions matching
+// filter, ordered by sort. An empty cursor starts at the first page; otherwise it is the
+// NextCursor of the previous page, and must have been issued for the same sort. Pages are
+// keyed on the last row's sort value rather than an offset, so transactions added while paging
+// never shift rows onto a page already read.
+func ListTransactionsAuthorized(filter TransactionFilter, sort TransactionSort, cursor string, limit int, authenticatedUserID int, db *sql.DB) (TransactionPage, error) {
+	page := TransactionPage{Transactions: []Transaction{}}
+
+	column, ok := transactionSortColumns[sort.Field]
+	if !ok {
+		return page, fmt.Errorf("unknown transaction sort %q", sort.Field)
+	}
+	direction, comparison := "ASC", ">"
+	if sort.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	where, args := transactionFilterClause(filter, authenticatedUserID)
+	if cursor != "" {
+		after, err := parseTransactionCursor(cursor, sort)
+		if err != nil {
+			return page, err
+		}
+
+		var value any
+		placeholder := fmt.Sprintf("$%d", len(args)+1)
+		switch sort.Field {
+		case models.TransactionSortDate, models.TransactionSortDateAdded:
+			value = after.Time
+		case models.TransactionSortAmount:
+			value = after.Amount
+			placeholder = fmt.Sprintf("(%s)::NUMERIC(14,2) / 100", placeholder)
+		case models.TransactionSortDescription:
+			value = after.Description
+		}
+		args = append(args, value, after.TransactionId)
+		where += fmt.Sprintf(" AND (%s, t.transaction_id) %s (%s, $%d)", column, comparison, placeholder, len(args))
+	}
+
+	// One row beyond the page tells us whether there is a next one
+	args = append(args, limit+1)
+	query := `
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, '')
+		FROM transaction t
+		JOIN statement s on s.statement_id = t.statement_id
+		` + where + `
+		ORDER BY ` + column + ` ` + direction + `, t.transaction_id ` + direction + `
+		LIMIT $` + fmt.Sprint(len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txn Transaction
+		if err := rows.Scan(
+			&txn.TransactionId,
+			&txn.StatementId,
+			&txn.TransactionTypeLookupCode,
+			&txn.Description,
+			&txn.Amount,
+			&txn.TransactionDate,
+			&txn.DateAdded,
+			&txn.DateUpdated,
+			&txn.ExternalId,
+			&txn.ValueDate,
+			&txn.CounterpartyName,
+			&txn.CounterpartyAccount,
+		); err != nil {
+			log.Print(err)
+			return page, err
+		}
+		page.Transactions = append(page.Transactions, txn)
+	}
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		return page, err
+	}
+
+	if len(page.Transactions) > limit {
+		page.Transactions = page.Transactions[:limit]
+		page.NextCursor = newTransactionCursor(sort, page.Transactions[limit-1])
+	}
+	return page, nil
+}
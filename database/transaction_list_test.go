@@ -0,0 +1,83 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"moneyd/api/models"
+	"testing"
+	"time"
+)
+
+func TestTransactionCursorRoundTrip(t *testing.T) {
+	txn := Transaction{
+		TransactionId:   42,
+		Description:     "Café \"Zürich\" & co",
+		Amount:          -1999,
+		TransactionDate: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC),
+		DateAdded:       time.Date(2026, 2, 1, 13, 14, 15, 123456000, time.FixedZone("CET", 3600)),
+	}
+
+	tests := []struct {
+		sort TransactionSort
+		want transactionCursor
+	}{
+		{
+			sort: TransactionSort{Field: models.TransactionSortDate, Descending: true},
+			want: transactionCursor{Sort: models.TransactionSortDate, Descending: true, Time: txn.TransactionDate, TransactionId: 42},
+		},
+		{
+			sort: TransactionSort{Field: models.TransactionSortDateAdded},
+			want: transactionCursor{Sort: models.TransactionSortDateAdded, Time: txn.DateAdded, TransactionId: 42},
+		},
+		{
+			sort: TransactionSort{Field: models.TransactionSortAmount, Descending: true},
+			want: transactionCursor{Sort: models.TransactionSortAmount, Descending: true, Amount: -1999, TransactionId: 42},
+		},
+		{
+			sort: TransactionSort{Field: models.TransactionSortDescription},
+			want: transactionCursor{Sort: models.TransactionSortDescription, Description: txn.Description, TransactionId: 42},
+		},
+	}
+
+	for _, tt := range tests {
+		encoded := newTransactionCursor(tt.sort, txn)
+		got, err := parseTransactionCursor(encoded, tt.sort)
+		if err != nil {
+			t.Errorf("%+v: parseTransactionCursor(%q) returned error: %v", tt.sort, encoded, err)
+			continue
+		}
+		if got.Sort != tt.want.Sort || got.Descending != tt.want.Descending || !got.Time.Equal(tt.want.Time) ||
+			got.Amount != tt.want.Amount || got.Description != tt.want.Description || got.TransactionId != tt.want.TransactionId {
+			t.Errorf("%+v: cursor round trip = %+v, want %+v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestParseTransactionCursorRejects(t *testing.T) {
+	txn := Transaction{TransactionId: 42, Amount: 100}
+	byAmount := TransactionSort{Field: models.TransactionSortAmount, Descending: true}
+	cursor := newTransactionCursor(byAmount, txn)
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   TransactionSort
+	}{
+		{name: "different field", cursor: cursor, sort: TransactionSort{Field: models.TransactionSortDate, Descending: true}},
+		{name: "different direction", cursor: cursor, sort: TransactionSort{Field: models.TransactionSortAmount}},
+		{name: "not base64", cursor: "%%%", sort: byAmount},
+		{name: "padded base64", cursor: cursor + "==", sort: byAmount},
+		{name: "not JSON", cursor: encode("amount=100"), sort: byAmount},
+		{name: "no transaction id", cursor: encode(`{"sort":"amount","descending":true,"amount":100}`), sort: byAmount},
+		{name: "negative transaction id", cursor: encode(`{"sort":"amount","descending":true,"transaction_id":-1}`), sort: byAmount},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseTransactionCursor(tt.cursor, tt.sort); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: parseTransactionCursor() error = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
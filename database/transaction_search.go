@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"moneyd/api/models"
+	"strconv"
+	"strings"
+)
+
+type TransactionSearchResult = models.TransactionSearchResult
+
+// ts_headline marks matches with control characters rather than tags, so the text around them
+// can be HTML-escaped before the markers become <mark> tags
+const (
+	snippetStart   = "\x02"
+	snippetStop    = "\x03"
+	snippetOptions = "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", HighlightAll=true"
+)
+
+var snippetMarkers = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// SearchTransactionsAuthorized returns up to limit of the authenticated user's transactions
+// matching filter whose description or counterparty name matches text, best match first. text is
+// read as a web search query ("quoted phrases", -excluded words, or) against the full-text index,
+// and a transaction also matches if text is similar to a run of words in its description or
+// counterparty name, which finds misspellings and partial merchant codes. Full-text matches on the
+// description rank highest.
+func SearchTransactionsAuthorized(text string, filter TransactionFilter, limit int, authenticatedUserID int, db *sql.DB) ([]TransactionSearchResult, error) {
+	results := []TransactionSearchResult{}
+
+	where, args := transactionFilterClause(filter, authenticatedUserID)
+	args = append(args, text)
+	textArg := "$" + strconv.Itoa(len(args))
+	args = append(args, snippetOptions)
+	optionsArg := "$" + strconv.Itoa(len(args))
+	args = append(args, limit)
+	limitArg := "$" + strconv.Itoa(len(args))
+
+	query := `
+	WITH search AS (
+		SELECT websearch_to_tsquery('english', ` + textArg + `) AS query
+	)
+	SELECT t.transaction_id, t.statement_id, t.transaction_type_lookup_code, t.description, (t.amount * 100)::INTEGER, t.transaction_date, t.date_added, t.date_updated, COALESCE(t.external_id, ''), t.value_date, COALESCE(t.counterparty_name, ''), COALESCE(t.counterparty_account, ''),
+		ts_rank_cd(t.search_vector, search.query) + GREATEST(word_similarity(` + textArg + `, t.description), word_similarity(` + textArg + `, COALESCE(t.counterparty_name, '')) / 2) AS rank,
+		ts_headline('english', t.description, search.query, ` + optionsArg + `),
+		ts_headline('english', COALESCE(t.counterparty_name, ''), search.query, ` + optionsArg + `)
+		FROM transaction t
+		JOIN statement s on s.statement_id = t.statement_id
+		CROSS JOIN search
+		` + where + `
+		AND (
+			t.search_vector @@ search.query
+			OR ` + textArg + ` <% t.description
+			OR ` + textArg + ` <% t.counterparty_name
+		)
+		ORDER BY rank DESC, t.transaction_date DESC, t.transaction_id DESC
+		LIMIT ` + limitArg
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return results, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result TransactionSearchResult
+		if err := rows.Scan(
+			&result.TransactionId,
+			&result.StatementId,
+			&result.TransactionTypeLookupCode,
+			&result.Description,
+			&result.Amount,
+			&result.TransactionDate,
+			&result.DateAdded,
+			&result.DateUpdated,
+			&result.ExternalId,
+			&result.ValueDate,
+			&result.CounterpartyName,
+			&result.CounterpartyAccount,
+			&result.Rank,
+			&result.DescriptionSnippet,
+			&result.CounterpartySnippet,
+		); err != nil {
+			log.Print(err)
+			return results, err
+		}
+		result.DescriptionSnippet = highlightSnippet(result.DescriptionSnippet)
+		result.CounterpartySnippet = highlightSnippet(result.CounterpartySnippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		log.Print(err)
+		return results, err
+	}
+
+	return results, nil
+}
+
+func highlightSnippet(s string) string {
+	return snippetMarkers.Replace(html.EscapeString(s))
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"log"
 	"moneyd/api/models"
 )
 
@@ -38,3 +39,84 @@ func GetTransactionTypes(db *sql.DB) ([]TransactionTypeLookup, error) {
 
 	return transactiontypes, nil
 }
+
+func GetTransactionType(code int, db *sql.DB) (TransactionTypeLookup, error) {
+	var transactiontype TransactionTypeLookup
+	query := `
+		SELECT transaction_type_lookup_code, description
+		FROM transaction_type_lookup
+		WHERE transaction_type_lookup_code = $1
+		`
+	err := db.QueryRow(query, code).Scan(
+		&transactiontype.TransactionTypeLookupCode,
+		&transactiontype.Description,
+	)
+	if err != nil {
+		log.Print(err)
+		return transactiontype, err
+	}
+
+	return transactiontype, nil
+}
+
+func CreateTransactionType(transactiontype TransactionTypeLookup, db *sql.DB) (TransactionTypeLookup, error) {
+	query := `
+		INSERT INTO transaction_type_lookup (transaction_type_lookup_code, description)
+		VALUES ($1, $2)
+		RETURNING transaction_type_lookup_code, description
+		`
+	err := db.QueryRow(query,
+		transactiontype.TransactionTypeLookupCode,
+		transactiontype.Description,
+	).Scan(
+		&transactiontype.TransactionTypeLookupCode,
+		&transactiontype.Description,
+	)
+	if err != nil {
+		log.Print(err)
+		return transactiontype, err
+	}
+
+	return transactiontype, nil
+}
+
+func UpdateTransactionType(code int, transactiontype TransactionTypeLookup, db *sql.DB) (TransactionTypeLookup, error) {
+	query := `
+		UPDATE transaction_type_lookup
+		SET description = $1
+		WHERE transaction_type_lookup_code = $2
+		RETURNING transaction_type_lookup_code, description
+		`
+	err := db.QueryRow(query,
+		transactiontype.Description,
+		code,
+	).Scan(
+		&transactiontype.TransactionTypeLookupCode,
+		&transactiontype.Description,
+	)
+	if err != nil {
+		log.Print(err)
+		return transactiontype, err
+	}
+
+	return transactiontype, nil
+}
+
+func DeleteTransactionType(code int, db *sql.DB) (TransactionTypeLookup, error) {
+	var transactiontype TransactionTypeLookup
+	query := `
+		DELETE FROM transaction_type_lookup
+		WHERE transaction_type_lookup_code = $1
+		RETURNING transaction_type_lookup_code, description
+		`
+	err := db.QueryRow(query, code).Scan(
+		&transactiontype.TransactionTypeLookupCode,
+		&transactiontype.Description,
+	)
+	if err != nil {
+		log.Print(err)
+		return transactiontype, err
+	}
+
+	return transactiontype, nil
+}
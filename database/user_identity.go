@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+	"moneyd/api/utils"
+	"time"
+)
+
+type UserIdentity = models.UserIdentity
+
+// CreateOidcLoginState remembers the PKCE verifier and nonce for an authorization request
+// until the provider redirects back. Stale requests are cleared out on the way.
+func CreateOidcLoginState(stateHash string, codeVerifier string, nonce string, ttl time.Duration, db *sql.DB) error {
+	if _, err := db.Exec(`DELETE FROM oidc_login_state WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		log.Print(err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_state (state_hash, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4))
+	`
+	_, err := db.Exec(query, stateHash, codeVerifier, nonce, ttl.Seconds())
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeOidcLoginState returns and deletes a pending authorization request so each state
+// value can only complete one login
+func ConsumeOidcLoginState(stateHash string, db *sql.DB) (string, string, error) {
+	var codeVerifier, nonce string
+	query := `
+		DELETE FROM oidc_login_state
+		WHERE state_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING code_verifier, nonce
+	`
+	err := db.QueryRow(query, stateHash).Scan(&codeVerifier, &nonce)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return "", "", err
+	}
+	return codeVerifier, nonce, nil
+}
+
+func GetUserByIdentity(issuer string, subject string, db *sql.DB) (User, error) {
+	var user User
+	query := `
+		SELECT u.banking_user_id, u.username, u.email, u.password_hash, u.role, u.disabled_at, u.date_created, u.date_updated
+		FROM banking_user u
+		JOIN user_identity i ON i.banking_user_id = u.banking_user_id
+		WHERE i.issuer = $1 AND i.subject = $2
+	`
+	err := db.QueryRow(query, issuer, subject).Scan(&user.BankingUserId, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.DisabledAt, &user.DateCreated, &user.DateUpdated)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return user, err
+	}
+	return user, nil
+}
+
+func CreateUserIdentity(identity UserIdentity, db *sql.DB) (UserIdentity, error) {
+	query := `
+		INSERT INTO user_identity (banking_user_id, issuer, subject, email, date_created)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		RETURNING user_identity_id, banking_user_id, issuer, subject, email, date_created
+	`
+	err := db.QueryRow(query, identity.BankingUserId, identity.Issuer, identity.Subject, identity.Email).Scan(
+		&identity.UserIdentityId,
+		&identity.BankingUserId,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&identity.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return identity, err
+	}
+	return identity, nil
+}
+
+// CreateUserWithIdentity signs up a user who arrived through an identity provider. They get
+// a random password they never see, so only the provider (or a password reset) lets them in.
+func CreateUserWithIdentity(user User, identity UserIdentity, emailVerified bool, db *sql.DB) (User, error) {
+	randomPassword, err := utils.GenerateToken(32)
+	if err != nil {
+		return user, err
+	}
+	user.PasswordHash, err = utils.HashPassword(randomPassword)
+	if err != nil {
+		return user, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	userQuery := `
+        INSERT INTO banking_user (username, email, password_hash, email_verified_at, date_created, date_updated)
+        VALUES ($1, $2, $3, CASE WHEN $4 THEN CURRENT_TIMESTAMP END, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+        RETURNING banking_user_id, role, date_created, date_updated
+        `
+	err = tx.QueryRow(userQuery, user.Username, user.Email, user.PasswordHash, emailVerified).Scan(&user.BankingUserId, &user.Role, &user.DateCreated, &user.DateUpdated)
+	if err != nil {
+		log.Print(err)
+		return user, err
+	}
+
+	identityQuery := `
+		INSERT INTO user_identity (banking_user_id, issuer, subject, email, date_created)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	`
+	if _, err := tx.Exec(identityQuery, user.BankingUserId, identity.Issuer, identity.Subject, identity.Email); err != nil {
+		log.Print(err)
+		return user, err
+	}
+
+	return user, tx.Commit()
+}
+
+// GetUserIdentitiesByUserId lists the identity provider accounts linked to a user
+func GetUserIdentitiesByUserId(userID int, db *sql.DB) ([]UserIdentity, error) {
+	query := `
+		SELECT user_identity_id, banking_user_id, issuer, subject, email, date_created
+		FROM user_identity
+		WHERE banking_user_id = $1
+		ORDER BY date_created
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []UserIdentity{}
+	for rows.Next() {
+		var identity UserIdentity
+		if err := rows.Scan(
+			&identity.UserIdentityId,
+			&identity.BankingUserId,
+			&identity.Issuer,
+			&identity.Subject,
+			&identity.Email,
+			&identity.DateCreated,
+		); err != nil {
+			return identities, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"moneyd/api/models"
+	"moneyd/api/utils"
+	"time"
+)
+
+type UserToken = models.UserToken
+
+// CreateUserToken stores a new token for the given purpose. Any earlier unused token for the
+// same purpose is retired so only the most recent email link works.
+func CreateUserToken(userID int, purpose string, tokenHash string, ttl time.Duration, db *sql.DB) (UserToken, error) {
+	var token UserToken
+	tx, err := db.Begin()
+	if err != nil {
+		return token, err
+	}
+	defer tx.Rollback()
+
+	retireQuery := `
+		UPDATE user_token
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	if _, err := tx.Exec(retireQuery, userID, purpose); err != nil {
+		log.Print(err)
+		return token, err
+	}
+
+	query := `
+		INSERT INTO user_token (banking_user_id, purpose, token_hash, expires_at, date_created)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(secs => $4), CURRENT_TIMESTAMP)
+		RETURNING user_token_id, banking_user_id, purpose, token_hash, expires_at, used_at, date_created
+	`
+	err = tx.QueryRow(query, userID, purpose, tokenHash, ttl.Seconds()).Scan(
+		&token.UserTokenId,
+		&token.BankingUserId,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.DateCreated,
+	)
+	if err != nil {
+		log.Print(err)
+		return token, err
+	}
+
+	return token, tx.Commit()
+}
+
+// ConsumeUserToken marks a token as used and returns it, or sql.ErrNoRows if the token is
+// unknown, expired, already used or was issued for a different purpose
+func ConsumeUserToken(purpose string, tokenHash string, db *sql.DB) (UserToken, error) {
+	return consumeUserToken(db, purpose, tokenHash)
+}
+
+func consumeUserToken(q querier, purpose string, tokenHash string) (UserToken, error) {
+	var token UserToken
+	query := `
+		UPDATE user_token
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1
+		AND purpose = $2
+		AND used_at IS NULL
+		AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_token_id, banking_user_id, purpose, token_hash, expires_at, used_at, date_created
+	`
+	err := q.QueryRow(query, tokenHash, purpose).Scan(
+		&token.UserTokenId,
+		&token.BankingUserId,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.DateCreated,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return token, err
+	}
+	return token, nil
+}
+
+// ResetPasswordWithToken consumes a password reset token and, in the same transaction, sets the
+// new password, revokes every session and personal access token of the token's owner and marks
+// their email verified, since following the emailed link proves they own the address. It returns
+// sql.ErrNoRows if the token is not a valid reset token; nothing changes unless every step does.
+func ResetPasswordWithToken(tokenHash string, plainPassword string, db *sql.DB) (UserToken, error) {
+	passwordHash, err := utils.HashPassword(plainPassword)
+	if err != nil {
+		log.Print(err)
+		return UserToken{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Print(err)
+		return UserToken{}, err
+	}
+	defer tx.Rollback()
+
+	token, err := consumeUserToken(tx, models.UserTokenPasswordReset, tokenHash)
+	if err != nil {
+		return token, err
+	}
+
+	// Whoever had the old password may still hold live sessions or tokens they minted with it
+	query := `
+		UPDATE banking_user
+		SET password_hash = $1,
+		    email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP),
+		    date_updated = CURRENT_TIMESTAMP
+		WHERE banking_user_id = $2
+	`
+	if _, err := tx.Exec(query, passwordHash, token.BankingUserId); err != nil {
+		log.Print(err)
+		return token, err
+	}
+	if _, err := revokeAllSessions(tx, token.BankingUserId); err != nil {
+		return token, err
+	}
+	if _, err := revokeAllPersonalAccessTokens(tx, token.BankingUserId); err != nil {
+		return token, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		return token, err
+	}
+	return token, nil
+}
@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"io"
+	"moneyd/api/models"
+	"strconv"
+)
+
+var csvHeader = []string{
+	"transaction_id",
+	"statement_id",
+	"institution",
+	"transaction_date",
+	"value_date",
+	"description",
+	"amount",
+	"transaction_type_lookup_code",
+	"counterparty_name",
+	"counterparty_account",
+	"external_id",
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter writes a header row followed by one row per transaction. Amounts are signed
+// decimals with a "." separator and dates are YYYY-MM-DD.
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.w.Write(csvHeader)
+}
+
+func (w *csvWriter) Write(txn models.ExportedTransaction) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	valueDate := ""
+	if txn.ValueDate != nil {
+		valueDate = txn.ValueDate.Format("2006-01-02")
+	}
+	return w.w.Write([]string{
+		strconv.Itoa(txn.TransactionId),
+		strconv.Itoa(txn.StatementId),
+		txn.InstitutionName,
+		txn.TransactionDate.Format("2006-01-02"),
+		valueDate,
+		txn.Description,
+		FormatAmount(txn.Amount),
+		strconv.Itoa(txn.TransactionTypeLookupCode),
+		txn.CounterpartyName,
+		txn.CounterpartyAccount,
+		txn.ExternalId,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
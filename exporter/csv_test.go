@@ -0,0 +1,36 @@
+package exporter
+
+import (
+	"moneyd/api/models"
+	"strings"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		txns []models.ExportedTransaction
+		want string
+	}{
+		{
+			name: "empty export still has a header",
+			want: "transaction_id,statement_id,institution,transaction_date,value_date,description,amount,transaction_type_lookup_code,counterparty_name,counterparty_account,external_id\n",
+		},
+		{
+			name: "transactions",
+			txns: testTransactions(),
+			want: "transaction_id,statement_id,institution,transaction_date,value_date,description,amount,transaction_type_lookup_code,counterparty_name,counterparty_account,external_id\n" +
+				"11,3,First Bank,2026-01-05,2026-01-06,\"Groceries, weekly\",-42.10,2,\"Grocer & \"\"Sons\"\"\",DE02100100100006820101,FIT-1\n" +
+				"12,3,First Bank,2026-01-10,,\"Salary\nJanuary\",1500.00,1,,,\n" +
+				"13,4,credit union (visa),2026-01-02,,Card fee,-0.99,2,,,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		writeAll(t, NewCSVWriter(&out), tt.txns)
+		if out.String() != tt.want {
+			t.Errorf("%s: CSV export =\n%s\nwant\n%s", tt.name, out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Package exporter writes transactions out in formats other tools can import. Writers stream:
+// each transaction is encoded as it is written, so an export never has to fit in memory.
+package exporter
+
+import (
+	"fmt"
+	"moneyd/api/models"
+)
+
+// Writer encodes a stream of transactions. Close finishes the file and must be called even if
+// nothing was written.
+type Writer interface {
+	Write(txn models.ExportedTransaction) error
+	Close() error
+}
+
+// FormatAmount renders signed cents as a decimal amount such as "-12.34"
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"moneyd/api/models"
+	"testing"
+	"time"
+)
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1234, "12.34"},
+		{-123456, "-1234.56"},
+		{100, "1.00"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatAmount(tt.cents); got != tt.want {
+			t.Errorf("FormatAmount(%d) = %q, want %q", tt.cents, got, tt.want)
+		}
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// testTransactions are two transactions at one institution and one at another, in the grouped
+// order the export queries return them
+func testTransactions() []models.ExportedTransaction {
+	valueDate := date(2026, 1, 6)
+	return []models.ExportedTransaction{
+		{
+			Transaction: models.Transaction{
+				TransactionId:             11,
+				StatementId:               3,
+				TransactionTypeLookupCode: 2,
+				Description:               "Groceries, weekly",
+				Amount:                    -4210,
+				TransactionDate:           date(2026, 1, 5),
+				ValueDate:                 &valueDate,
+				ExternalId:                "FIT-1",
+				CounterpartyName:          "Grocer & \"Sons\"",
+				CounterpartyAccount:       "DE02100100100006820101",
+			},
+			InstitutionId:   7,
+			InstitutionName: "First Bank",
+		},
+		{
+			Transaction: models.Transaction{
+				TransactionId:             12,
+				StatementId:               3,
+				TransactionTypeLookupCode: 1,
+				Description:               "Salary\nJanuary",
+				Amount:                    150000,
+				TransactionDate:           date(2026, 1, 10),
+			},
+			InstitutionId:   7,
+			InstitutionName: "First Bank",
+		},
+		{
+			Transaction: models.Transaction{
+				TransactionId:             13,
+				StatementId:               4,
+				TransactionTypeLookupCode: 2,
+				Description:               "Card fee",
+				Amount:                    -99,
+				TransactionDate:           date(2026, 1, 2),
+			},
+			InstitutionId:   8,
+			InstitutionName: "credit union (visa)",
+		},
+	}
+}
+
+func writeAll(t *testing.T, w Writer, txns []models.ExportedTransaction) {
+	t.Helper()
+	for _, txn := range txns {
+		if err := w.Write(txn); err != nil {
+			t.Fatalf("Write(%d) returned error: %v", txn.TransactionId, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package exporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"moneyd/api/models"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	DefaultLedgerCurrency = "USD"
+	unknownLedgerAccount  = "Unknown"
+)
+
+// Account names follow Beancount's rules, the strictest of the three formats, so one mapping
+// works for all of them
+var (
+	ledgerAccountName  = regexp.MustCompile(`^(Assets|Liabilities|Equity|Income|Expenses)(:[A-Z0-9][A-Za-z0-9-]*)+$`)
+	ledgerCurrencyName = regexp.MustCompile(`^[A-Z][A-Z0-9'._-]{0,22}[A-Z0-9]$`)
+)
+
+// ValidateLedgerMapping checks that every account and the currency are valid in Ledger, hledger
+// and Beancount alike
+func ValidateLedgerMapping(mapping models.LedgerAccountMapping) error {
+	if mapping.Currency != "" && !ledgerCurrencyName.MatchString(mapping.Currency) {
+		return fmt.Errorf("currency %q must be upper case letters and digits, such as USD", mapping.Currency)
+	}
+	for _, accounts := range []map[int]string{mapping.InstitutionAccounts, mapping.TransactionTypeAccounts} {
+		for _, account := range accounts {
+			if !ledgerAccountName.MatchString(account) {
+				return fmt.Errorf("account %q must start with Assets, Liabilities, Equity, Income or Expenses, followed by \":\"-separated names that each start with a capital letter or digit", account)
+			}
+		}
+	}
+	return nil
+}
+
+// LedgerOptions configures a plain-text accounting export
+type LedgerOptions struct {
+	// Format is models.ExportFormatLedger, models.ExportFormatHledger or models.ExportFormatBeancount
+	Format  string
+	Mapping models.LedgerAccountMapping
+	// TransactionTypes maps transaction_type_lookup codes to their descriptions, used to name
+	// accounts for unmapped types
+	TransactionTypes map[int]string
+}
+
+type ledgerWriter struct {
+	w        *bufio.Writer
+	opts     LedgerOptions
+	started  bool
+	currency string
+	// opened records the first date each account is used, for Beancount's open directives
+	opened map[string]time.Time
+}
+
+// NewLedgerWriter writes transactions as a Ledger or hledger journal, or a Beancount file. Each
+// transaction becomes a two-posting entry between its institution's account and its type's
+// account. Account declarations (Beancount open directives) are collected while writing and
+// appended at the end, which all three tools accept.
+func NewLedgerWriter(w io.Writer, opts LedgerOptions) (Writer, error) {
+	switch opts.Format {
+	case models.ExportFormatLedger, models.ExportFormatHledger, models.ExportFormatBeancount:
+	default:
+		return nil, fmt.Errorf("unknown plain-text accounting format %q", opts.Format)
+	}
+	if err := ValidateLedgerMapping(opts.Mapping); err != nil {
+		return nil, err
+	}
+
+	currency := opts.Mapping.Currency
+	if currency == "" {
+		currency = DefaultLedgerCurrency
+	}
+	return &ledgerWriter{
+		w:        bufio.NewWriter(w),
+		opts:     opts,
+		currency: currency,
+		opened:   make(map[string]time.Time),
+	}, nil
+}
+
+func (w *ledgerWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	if w.opts.Format == models.ExportFormatBeancount {
+		fmt.Fprintf(w.w, ";; Exported from moneyd on %s\n", time.Now().Format("2006-01-02"))
+		fmt.Fprintf(w.w, "option \"operating_currency\" %s\n\n", beancountString(w.currency))
+		return
+	}
+	fmt.Fprintf(w.w, "; Exported from moneyd on %s\n\n", time.Now().Format("2006-01-02"))
+}
+
+// institutionAccount is the account the money sits in
+func (w *ledgerWriter) institutionAccount(txn models.ExportedTransaction) string {
+	if account, ok := w.opts.Mapping.InstitutionAccounts[txn.InstitutionId]; ok {
+		return account
+	}
+	return "Assets:" + ledgerAccountComponent(txn.InstitutionName)
+}
+
+// typeAccount is the account on the other side of the transaction
+func (w *ledgerWriter) typeAccount(txn models.ExportedTransaction) string {
+	code := txn.TransactionTypeLookupCode
+	if account, ok := w.opts.Mapping.TransactionTypeAccounts[code]; ok {
+		return account
+	}
+	root := "Expenses:"
+	if txn.Amount > 0 {
+		root = "Income:"
+	}
+	return root + ledgerAccountComponent(w.opts.TransactionTypes[code])
+}
+
+func (w *ledgerWriter) use(account string, date time.Time) {
+	if first, ok := w.opened[account]; !ok || date.Before(first) {
+		w.opened[account] = date
+	}
+}
+
+func (w *ledgerWriter) Write(txn models.ExportedTransaction) error {
+	w.start()
+
+	asset := w.institutionAccount(txn)
+	other := w.typeAccount(txn)
+	w.use(asset, txn.TransactionDate)
+	w.use(other, txn.TransactionDate)
+
+	date := txn.TransactionDate.Format("2006-01-02")
+	amount := FormatAmount(txn.Amount)
+	negated := FormatAmount(-txn.Amount)
+
+	if w.opts.Format == models.ExportFormatBeancount {
+		payee := ""
+		if txn.CounterpartyName != "" {
+			payee = beancountString(txn.CounterpartyName) + " "
+		}
+		fmt.Fprintf(w.w, "%s * %s%s\n", date, payee, beancountString(txn.Description))
+		fmt.Fprintf(w.w, "  transaction_id: %d\n", txn.TransactionId)
+		fmt.Fprintf(w.w, "  statement_id: %d\n", txn.StatementId)
+		if txn.ExternalId != "" {
+			fmt.Fprintf(w.w, "  external_id: %s\n", beancountString(txn.ExternalId))
+		}
+		if txn.ValueDate != nil {
+			fmt.Fprintf(w.w, "  value_date: %s\n", txn.ValueDate.Format("2006-01-02"))
+		}
+		fmt.Fprintf(w.w, "  %s  %s %s\n", asset, amount, w.currency)
+		fmt.Fprintf(w.w, "  %s  %s %s\n", other, negated, w.currency)
+		_, err := fmt.Fprint(w.w, "\n")
+		return err
+	}
+
+	// Ledger and hledger share this syntax: an optional secondary date after "=", the code in
+	// parentheses, and tags as "name: value" comments
+	if txn.ValueDate != nil {
+		date += "=" + txn.ValueDate.Format("2006-01-02")
+	}
+	code := ""
+	if txn.ExternalId != "" {
+		code = " (" + ledgerText(txn.ExternalId) + ")"
+	}
+	fmt.Fprintf(w.w, "%s *%s %s\n", date, code, ledgerText(txn.Description))
+	fmt.Fprintf(w.w, "    ; transaction_id: %d\n", txn.TransactionId)
+	fmt.Fprintf(w.w, "    ; statement_id: %d\n", txn.StatementId)
+	if txn.CounterpartyName != "" {
+		fmt.Fprintf(w.w, "    ; counterparty: %s\n", ledgerText(txn.CounterpartyName))
+	}
+	fmt.Fprintf(w.w, "    %s  %s %s\n", asset, amount, w.currency)
+	fmt.Fprintf(w.w, "    %s  %s %s\n", other, negated, w.currency)
+	_, err := fmt.Fprint(w.w, "\n")
+	return err
+}
+
+func (w *ledgerWriter) Close() error {
+	w.start()
+
+	accounts := make([]string, 0, len(w.opened))
+	for account := range w.opened {
+		accounts = append(accounts, account)
+	}
+	slices.Sort(accounts)
+
+	for _, account := range accounts {
+		if w.opts.Format == models.ExportFormatBeancount {
+			fmt.Fprintf(w.w, "%s open %s %s\n", w.opened[account].Format("2006-01-02"), account, w.currency)
+		} else {
+			fmt.Fprintf(w.w, "account %s\n", account)
+		}
+	}
+	return w.w.Flush()
+}
+
+// ledgerAccountComponent turns a free-text name into one valid account name component,
+// e.g. "Chase bank (checking)" becomes "Chase-Bank-Checking"
+func ledgerAccountComponent(name string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	}) {
+		words = append(words, strings.ToUpper(word[:1])+word[1:])
+	}
+	if len(words) == 0 {
+		return unknownLedgerAccount
+	}
+	return strings.Join(words, "-")
+}
+
+// ledgerText keeps free text on one line; Ledger has no quoting, so newlines are the only hazard
+func ledgerText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func beancountString(s string) string {
+	return strconv.Quote(ledgerText(s))
+}
@@ -0,0 +1,195 @@
+package exporter
+
+import (
+	"moneyd/api/models"
+	"strings"
+	"testing"
+)
+
+var testTransactionTypes = map[int]string{1: "Deposit", 2: "Card purchase"}
+
+func TestValidateLedgerMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping models.LedgerAccountMapping
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "valid", mapping: models.LedgerAccountMapping{
+			Currency:                "EUR",
+			InstitutionAccounts:     map[int]string{7: "Assets:Bank:Checking-1"},
+			TransactionTypeAccounts: map[int]string{2: "Expenses:Food"},
+		}},
+		{name: "lower case currency", mapping: models.LedgerAccountMapping{Currency: "eur"}, wantErr: true},
+		{name: "one letter currency", mapping: models.LedgerAccountMapping{Currency: "E"}, wantErr: true},
+		{name: "unknown root", mapping: models.LedgerAccountMapping{
+			InstitutionAccounts: map[int]string{7: "Bank:Checking"},
+		}, wantErr: true},
+		{name: "root only", mapping: models.LedgerAccountMapping{
+			TransactionTypeAccounts: map[int]string{2: "Expenses"},
+		}, wantErr: true},
+		{name: "lower case component", mapping: models.LedgerAccountMapping{
+			TransactionTypeAccounts: map[int]string{2: "Expenses:food"},
+		}, wantErr: true},
+		{name: "space in component", mapping: models.LedgerAccountMapping{
+			TransactionTypeAccounts: map[int]string{2: "Expenses:Eating Out"},
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateLedgerMapping(tt.mapping)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateLedgerMapping() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLedgerWriter(t *testing.T) {
+	mapping := models.LedgerAccountMapping{
+		InstitutionAccounts:     map[int]string{7: "Assets:Bank:Checking"},
+		TransactionTypeAccounts: map[int]string{2: "Expenses:Shopping"},
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		mapping models.LedgerAccountMapping
+		want    string
+	}{
+		{
+			name:    "ledger",
+			format:  models.ExportFormatLedger,
+			mapping: mapping,
+			want: `2026-01-05=2026-01-06 * (FIT-1) Groceries, weekly
+    ; transaction_id: 11
+    ; statement_id: 3
+    ; counterparty: Grocer & "Sons"
+    Assets:Bank:Checking  -42.10 USD
+    Expenses:Shopping  42.10 USD
+
+2026-01-10 * Salary January
+    ; transaction_id: 12
+    ; statement_id: 3
+    Assets:Bank:Checking  1500.00 USD
+    Income:Deposit  -1500.00 USD
+
+2026-01-02 * Card fee
+    ; transaction_id: 13
+    ; statement_id: 4
+    Assets:Credit-Union-Visa  -0.99 USD
+    Expenses:Shopping  0.99 USD
+
+account Assets:Bank:Checking
+account Assets:Credit-Union-Visa
+account Expenses:Shopping
+account Income:Deposit
+`,
+		},
+		{
+			name:    "hledger without a mapping",
+			format:  models.ExportFormatHledger,
+			mapping: models.LedgerAccountMapping{Currency: "EUR"},
+			want: `2026-01-05=2026-01-06 * (FIT-1) Groceries, weekly
+    ; transaction_id: 11
+    ; statement_id: 3
+    ; counterparty: Grocer & "Sons"
+    Assets:First-Bank  -42.10 EUR
+    Expenses:Card-Purchase  42.10 EUR
+
+2026-01-10 * Salary January
+    ; transaction_id: 12
+    ; statement_id: 3
+    Assets:First-Bank  1500.00 EUR
+    Income:Deposit  -1500.00 EUR
+
+2026-01-02 * Card fee
+    ; transaction_id: 13
+    ; statement_id: 4
+    Assets:Credit-Union-Visa  -0.99 EUR
+    Expenses:Card-Purchase  0.99 EUR
+
+account Assets:Credit-Union-Visa
+account Assets:First-Bank
+account Expenses:Card-Purchase
+account Income:Deposit
+`,
+		},
+		{
+			name:    "beancount",
+			format:  models.ExportFormatBeancount,
+			mapping: mapping,
+			want: `option "operating_currency" "USD"
+
+2026-01-05 * "Grocer & \"Sons\"" "Groceries, weekly"
+  transaction_id: 11
+  statement_id: 3
+  external_id: "FIT-1"
+  value_date: 2026-01-06
+  Assets:Bank:Checking  -42.10 USD
+  Expenses:Shopping  42.10 USD
+
+2026-01-10 * "Salary January"
+  transaction_id: 12
+  statement_id: 3
+  Assets:Bank:Checking  1500.00 USD
+  Income:Deposit  -1500.00 USD
+
+2026-01-02 * "Card fee"
+  transaction_id: 13
+  statement_id: 4
+  Assets:Credit-Union-Visa  -0.99 USD
+  Expenses:Shopping  0.99 USD
+
+2026-01-05 open Assets:Bank:Checking USD
+2026-01-02 open Assets:Credit-Union-Visa USD
+2026-01-02 open Expenses:Shopping USD
+2026-01-10 open Income:Deposit USD
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		w, err := NewLedgerWriter(&out, LedgerOptions{Format: tt.format, Mapping: tt.mapping, TransactionTypes: testTransactionTypes})
+		if err != nil {
+			t.Fatalf("%s: NewLedgerWriter() returned error: %v", tt.name, err)
+		}
+		writeAll(t, w, testTransactions())
+
+		// The first line records the export date
+		_, got, _ := strings.Cut(out.String(), "\n")
+		got = strings.TrimPrefix(got, "\n")
+		if got != tt.want {
+			t.Errorf("%s: export =\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewLedgerWriterRejects(t *testing.T) {
+	if _, err := NewLedgerWriter(&strings.Builder{}, LedgerOptions{Format: models.ExportFormatCsv}); err == nil {
+		t.Error("NewLedgerWriter() accepted the csv format")
+	}
+	invalid := models.LedgerAccountMapping{InstitutionAccounts: map[int]string{1: "Checking"}}
+	if _, err := NewLedgerWriter(&strings.Builder{}, LedgerOptions{Format: models.ExportFormatLedger, Mapping: invalid}); err == nil {
+		t.Error("NewLedgerWriter() accepted an invalid mapping")
+	}
+}
+
+func TestLedgerAccountComponent(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Chase bank (checking)", "Chase-Bank-Checking"},
+		{"ATM withdrawal", "ATM-Withdrawal"},
+		{"2nd account", "2nd-Account"},
+		{"", unknownLedgerAccount},
+		{"—", unknownLedgerAccount},
+	}
+
+	for _, tt := range tests {
+		if got := ledgerAccountComponent(tt.name); got != tt.want {
+			t.Errorf("ledgerAccountComponent(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"moneyd/api/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ofxNameLength is the longest NAME the OFX specification allows
+const ofxNameLength = 32
+
+// OFXOptions describes the statements in an OFX export
+type OFXOptions struct {
+	// Currency is the ISO 4217 code written as every statement's CURDEF
+	Currency string
+	// Start and End are the DTSTART and DTEND of every statement
+	Start time.Time
+	End   time.Time
+	// Institution, if set, is written as the signon FI's ORG
+	Institution string
+}
+
+type ofxWriter struct {
+	w             *bufio.Writer
+	opts          OFXOptions
+	started       bool
+	open          bool
+	institutionId int
+	total         int64
+}
+
+// NewOFXWriter writes an OFX 2.2 bank statement response with one statement per institution.
+// Transactions must arrive grouped by institution. There is no account number to export, so
+// BANKID and ACCTID both carry the institution ID, and since balances are not stored LEDGERBAL
+// is the sum of the exported amounts. Each FITID is the transaction's external ID when it has
+// one, so re-importing an export does not duplicate it.
+func NewOFXWriter(w io.Writer, opts OFXOptions) Writer {
+	return &ofxWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+func (w *ofxWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	fmt.Fprint(w.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`+"\n")
+	fmt.Fprint(w.w, `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n")
+	fmt.Fprint(w.w, "<OFX>\n<SIGNONMSGSRSV1>\n<SONRS>\n")
+	fmt.Fprint(w.w, "<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(w.w, "<DTSERVER>%s</DTSERVER>\n", time.Now().UTC().Format("20060102150405"))
+	fmt.Fprint(w.w, "<LANGUAGE>ENG</LANGUAGE>\n")
+	if w.opts.Institution != "" {
+		fmt.Fprintf(w.w, "<FI><ORG>%s</ORG></FI>\n", ofxText(w.opts.Institution))
+	}
+	fmt.Fprint(w.w, "</SONRS>\n</SIGNONMSGSRSV1>\n<BANKMSGSRSV1>\n")
+}
+
+func (w *ofxWriter) openStatement(institutionId int) {
+	w.open = true
+	w.institutionId = institutionId
+	w.total = 0
+
+	id := strconv.Itoa(institutionId)
+	fmt.Fprint(w.w, "<STMTTRNRS>\n")
+	fmt.Fprintf(w.w, "<TRNUID>%s</TRNUID>\n", id)
+	fmt.Fprint(w.w, "<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprint(w.w, "<STMTRS>\n")
+	fmt.Fprintf(w.w, "<CURDEF>%s</CURDEF>\n", ofxText(w.opts.Currency))
+	fmt.Fprintf(w.w, "<BANKACCTFROM><BANKID>%s</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n", id, id)
+	fmt.Fprint(w.w, "<BANKTRANLIST>\n")
+	fmt.Fprintf(w.w, "<DTSTART>%s</DTSTART>\n", ofxDate(w.opts.Start))
+	fmt.Fprintf(w.w, "<DTEND>%s</DTEND>\n", ofxDate(w.opts.End))
+}
+
+func (w *ofxWriter) closeStatement() {
+	if !w.open {
+		return
+	}
+	w.open = false
+
+	fmt.Fprint(w.w, "</BANKTRANLIST>\n")
+	fmt.Fprintf(w.w, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", FormatAmount(w.total), ofxDate(w.opts.End))
+	fmt.Fprint(w.w, "</STMTRS>\n</STMTTRNRS>\n")
+}
+
+func (w *ofxWriter) Write(txn models.ExportedTransaction) error {
+	w.start()
+	if !w.open || txn.InstitutionId != w.institutionId {
+		w.closeStatement()
+		w.openStatement(txn.InstitutionId)
+	}
+	w.total += txn.Amount
+
+	trnType := "CREDIT"
+	if txn.Amount < 0 {
+		trnType = "DEBIT"
+	}
+	fitId := txn.ExternalId
+	if fitId == "" {
+		fitId = "moneyd-" + strconv.Itoa(txn.TransactionId)
+	}
+	name := txn.CounterpartyName
+	if name == "" {
+		name = txn.Description
+	}
+
+	fmt.Fprint(w.w, "<STMTTRN>\n")
+	fmt.Fprintf(w.w, "<TRNTYPE>%s</TRNTYPE>\n", trnType)
+	fmt.Fprintf(w.w, "<DTPOSTED>%s</DTPOSTED>\n", ofxDate(txn.TransactionDate))
+	if txn.ValueDate != nil {
+		fmt.Fprintf(w.w, "<DTAVAIL>%s</DTAVAIL>\n", ofxDate(*txn.ValueDate))
+	}
+	fmt.Fprintf(w.w, "<TRNAMT>%s</TRNAMT>\n", FormatAmount(txn.Amount))
+	fmt.Fprintf(w.w, "<FITID>%s</FITID>\n", ofxText(fitId))
+	fmt.Fprintf(w.w, "<NAME>%s</NAME>\n", ofxText(truncateRunes(name, ofxNameLength)))
+	if txn.CounterpartyAccount != "" {
+		fmt.Fprintf(w.w, "<BANKACCTTO><BANKID>NONE</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTTO>\n", ofxText(txn.CounterpartyAccount))
+	}
+	if txn.Description != name {
+		fmt.Fprintf(w.w, "<MEMO>%s</MEMO>\n", ofxText(txn.Description))
+	}
+	_, err := fmt.Fprint(w.w, "</STMTTRN>\n")
+	return err
+}
+
+func (w *ofxWriter) Close() error {
+	w.start()
+	w.closeStatement()
+	fmt.Fprint(w.w, "</BANKMSGSRSV1>\n</OFX>\n")
+	return w.w.Flush()
+}
+
+func ofxDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+func ofxText(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
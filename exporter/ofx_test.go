@@ -0,0 +1,97 @@
+package exporter
+
+import (
+	"moneyd/api/importer"
+	"strings"
+	"testing"
+)
+
+func TestOFXWriter(t *testing.T) {
+	var out strings.Builder
+	writeAll(t, NewOFXWriter(&out, OFXOptions{
+		Currency:    "EUR",
+		Start:       date(2026, 1, 1),
+		End:         date(2026, 1, 31),
+		Institution: "First Bank",
+	}), testTransactions())
+	doc := out.String()
+
+	for _, want := range []string{
+		"<FI><ORG>First Bank</ORG></FI>",
+		"<CURDEF>EUR</CURDEF>",
+		"<BANKID>7</BANKID><ACCTID>7</ACCTID>",
+		"<BANKID>8</BANKID><ACCTID>8</ACCTID>",
+		"<TRNTYPE>DEBIT</TRNTYPE>\n<DTPOSTED>20260105</DTPOSTED>\n<DTAVAIL>20260106</DTAVAIL>\n<TRNAMT>-42.10</TRNAMT>\n<FITID>FIT-1</FITID>",
+		"<NAME>Grocer &amp; &#34;Sons&#34;</NAME>",
+		"<BANKACCTTO><BANKID>NONE</BANKID><ACCTID>DE02100100100006820101</ACCTID>",
+		"<MEMO>Groceries, weekly</MEMO>",
+		"<FITID>moneyd-12</FITID>",
+		"<LEDGERBAL><BALAMT>1457.90</BALAMT><DTASOF>20260131</DTASOF></LEDGERBAL>",
+		"<LEDGERBAL><BALAMT>-0.99</BALAMT>",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("OFX export does not contain %q:\n%s", want, doc)
+		}
+	}
+	if got := strings.Count(doc, "<STMTTRNRS>"); got != 2 {
+		t.Errorf("OFX export has %d statements, want one per institution", got)
+	}
+}
+
+// TestOFXWriterRoundTrip checks that a single-institution export reads back through the importer
+// with the same amounts, dates and identifiers
+func TestOFXWriterRoundTrip(t *testing.T) {
+	txns := testTransactions()[:2]
+
+	var out strings.Builder
+	writeAll(t, NewOFXWriter(&out, OFXOptions{Currency: "USD", Start: date(2026, 1, 1), End: date(2026, 1, 31)}), txns)
+
+	result, err := importer.ParseOFX(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatalf("ParseOFX() returned error: %v\n%s", err, out.String())
+	}
+	if len(result.Errors) > 0 || len(result.Transactions) != len(txns) {
+		t.Fatalf("ParseOFX() read %d transactions and errors %+v, want %d", len(result.Transactions), result.Errors, len(txns))
+	}
+
+	wantIds := []string{"FIT-1", "moneyd-12"}
+	wantDescriptions := []string{"Grocer & \"Sons\" Groceries, weekly", "Salary\nJanuary"}
+	for i, got := range result.Transactions {
+		if got.Amount != txns[i].Amount || !got.TransactionDate.Equal(txns[i].TransactionDate) ||
+			got.ExternalId != wantIds[i] || got.Description != wantDescriptions[i] {
+			t.Errorf("transaction %d read back as %+v", i, got)
+		}
+	}
+	if !result.Statement.PeriodStart.Equal(date(2026, 1, 1)) || !result.Statement.PeriodEnd.Equal(date(2026, 1, 31)) {
+		t.Errorf("period read back as %v to %v", result.Statement.PeriodStart, result.Statement.PeriodEnd)
+	}
+}
+
+func TestOFXWriterEmpty(t *testing.T) {
+	var out strings.Builder
+	writeAll(t, NewOFXWriter(&out, OFXOptions{Currency: "USD"}), nil)
+
+	doc := out.String()
+	if strings.Contains(doc, "<STMTTRNRS>") || !strings.HasSuffix(doc, "</BANKMSGSRSV1>\n</OFX>\n") {
+		t.Errorf("empty OFX export =\n%s", doc)
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc"},
+		{"Zürich Café", 6, "Zürich"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateRunes(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
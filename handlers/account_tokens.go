@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/mailer"
+	"moneyd/api/models"
+	"moneyd/api/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+	minPasswordLength    = 8
+)
+
+// accountLink builds the frontend URL a mailed token should be opened with
+func accountLink(path string, token string) string {
+	return os.Getenv("APP_BASE_URL") + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueUserToken creates a token for the user and mails them a link containing it
+func issueUserToken(user database.User, purpose string, ttl time.Duration, db *sql.DB, mail mailer.Mailer) error {
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.CreateUserToken(user.BankingUserId, purpose, utils.HashToken(token), ttl, db); err != nil {
+		return err
+	}
+
+	var msg mailer.Message
+	switch purpose {
+	case models.UserTokenPasswordReset:
+		msg = mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your moneyd password",
+			Body: fmt.Sprintf("Someone asked to reset the password for your moneyd account.\n\n"+
+				"Open this link within %d minutes to choose a new one:\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+				int(ttl.Minutes()), accountLink("/reset-password", token)),
+		}
+	case models.UserTokenEmailVerification:
+		msg = mailer.Message{
+			To:      user.Email,
+			Subject: "Verify your moneyd email address",
+			Body: fmt.Sprintf("Open this link to confirm this is your email address:\n%s\n",
+				accountLink("/verify-email", token)),
+		}
+	default:
+		return fmt.Errorf("unknown token purpose %q", purpose)
+	}
+
+	return mail.Send(msg)
+}
+
+// PasswordResetRequestHandler mails a reset link if the email belongs to an account. It always
+// answers the same way so the endpoint can't be used to discover which emails are registered.
+// Requests are throttled per email and per client address so it can't be used to flood an inbox.
+func PasswordResetRequestHandler(db *sql.DB, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resetRequest struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+
+		if err := c.ShouldBindJSON(&resetRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		// The email key is counted whether or not the account exists, so a 429 reveals nothing
+		accountKey := resetThrottleKey(accountThrottleKey(resetRequest.Email))
+		ipKey := resetThrottleKey(ipThrottleKey(c.ClientIP()))
+		if rejectIfLocked(c, []string{accountKey, ipKey}, db) {
+			return
+		}
+		resetAccountThrottle.recordFailure(accountKey, db)
+		resetIpThrottle.recordFailure(ipKey, db)
+
+		// Sending happens off the request path so response timing doesn't reveal whether it ran
+		go func() {
+			user, err := database.GetUserByEmail(resetRequest.Email, db)
+			if err != nil {
+				return
+			}
+			if err := issueUserToken(user, models.UserTokenPasswordReset, passwordResetTTL, db, mail); err != nil {
+				log.Print(err)
+			}
+		}()
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "If that email is registered, a reset link is on its way"})
+	}
+}
+
+// PasswordResetConfirmHandler sets a new password from a reset token and signs the user out
+// everywhere, revoking their personal access tokens too
+func PasswordResetConfirmHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var confirmRequest struct {
+			Token    string `json:"token" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&confirmRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		if len(confirmRequest.Password) < minPasswordLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Password must be at least %d characters", minPasswordLength)})
+			return
+		}
+
+		if _, err := database.ResetPasswordWithToken(utils.HashToken(confirmRequest.Token), confirmRequest.Password, db); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// EmailVerificationRequestHandler mails a verification link to the authenticated user's address
+func EmailVerificationRequestHandler(db *sql.DB, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		user, err := database.GetUser(userID, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+
+		if err := issueUserToken(user, models.UserTokenEmailVerification, emailVerificationTTL, db, mail); err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+	}
+}
+
+// EmailVerificationConfirmHandler marks the token owner's email as verified
+func EmailVerificationConfirmHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var confirmRequest struct {
+			Token string `json:"token" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&confirmRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		token, err := database.ConsumeUserToken(models.UserTokenEmailVerification, utils.HashToken(confirmRequest.Token), db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		if err := database.MarkEmailVerified(token.BankingUserId, db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"moneyd/api/database"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handlers for the admin API. They work on any row rather than the caller's own, so unlike the
+// generic handlers in global.go a missing row is a 404, invalid input is a 400 and a row that
+// other records still reference is a 409.
+
+func AdminGetHandler[T any](getFunc func(id int, db *sql.DB) (T, error), db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := adminItemId(c)
+		if err != nil {
+			return
+		}
+
+		item, err := getFunc(id, db)
+		if err != nil {
+			respondWithAdminError(c, err)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, item)
+	}
+}
+
+func AdminCreateHandler[T any](createFunc func(model T, db *sql.DB) (T, error), db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var model T
+		if err := c.ShouldBindJSON(&model); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		created, err := createFunc(model, db)
+		if err != nil {
+			respondWithAdminError(c, err)
+			return
+		}
+		c.IndentedJSON(http.StatusCreated, created)
+	}
+}
+
+func AdminUpdateHandler[T any](updateFunc func(id int, model T, db *sql.DB) (T, error), db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := adminItemId(c)
+		if err != nil {
+			return
+		}
+
+		var model T
+		if err := c.ShouldBindJSON(&model); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		updated, err := updateFunc(id, model, db)
+		if err != nil {
+			respondWithAdminError(c, err)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, updated)
+	}
+}
+
+func AdminDeleteHandler[T any](deleteFunc func(id int, db *sql.DB) (T, error), db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := adminItemId(c)
+		if err != nil {
+			return
+		}
+
+		deleted, err := deleteFunc(id, db)
+		if err != nil {
+			respondWithAdminError(c, err)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, deleted)
+	}
+}
+
+// adminItemId reads the :id route parameter, writing a 400 itself when it isn't a number
+func adminItemId(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, err
+	}
+	return id, nil
+}
+
+func respondWithAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+	case errors.Is(err, database.ErrUnknownRole):
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case database.IsForeignKeyViolation(err):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Resource is still in use by other records"})
+	default:
+		log.Print(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/exporter"
+	"moneyd/api/models"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dataExportTTL    = 7 * 24 * time.Hour
+	dataExportFormat = "moneyd-account-export"
+	// dataExportTempPattern names archives still being written
+	dataExportTempPattern = "export-*.zip.tmp"
+)
+
+// RequestDataExportHandler starts building an archive of everything the user has stored, written
+// under dir, and answers 202 straight away; the client polls the export until it has a
+// download_url. A user with an export still being built gets that one back instead of a second job.
+func RequestDataExportHandler(db *sql.DB, dir string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		export, created, err := database.CreateDataExport(c.GetInt("user_id"), db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if created {
+			go runDataExport(export, dir, db)
+		}
+
+		respondWithDataExport(c, http.StatusAccepted, export)
+	}
+}
+
+// ListDataExportsHandler lists the user's exports, newest first
+func ListDataExportsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exports, err := database.GetDataExportsByUserId(c.GetInt("user_id"), db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		for i := range exports {
+			setDataExportDownloadUrl(&exports[i])
+		}
+
+		c.IndentedJSON(http.StatusOK, exports)
+	}
+}
+
+// GetDataExportHandler reports the status of one export
+func GetDataExportHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		export, err := database.GetDataExportAuthorized(exportId, c.GetInt("user_id"), db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Resource not found or access denied"})
+			} else {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		respondWithDataExport(c, http.StatusOK, export)
+	}
+}
+
+// DownloadDataExportHandler serves a finished archive as a zip file
+func DownloadDataExportHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		archivePath, err := database.GetDataExportArchiveAuthorized(exportId, c.GetInt("user_id"), db)
+		if err == nil {
+			_, err = os.Stat(archivePath)
+		}
+		if err != nil {
+			if err == sql.ErrNoRows || errors.Is(err, fs.ErrNotExist) {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Export not found, not finished or expired"})
+			} else {
+				log.Print(err)
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.FileAttachment(archivePath, fmt.Sprintf("moneyd-export-%d.zip", exportId))
+	}
+}
+
+func respondWithDataExport(c *gin.Context, status int, export models.DataExport) {
+	setDataExportDownloadUrl(&export)
+	c.Header("Location", fmt.Sprintf("/account/exports/%d", export.DataExportId))
+	c.IndentedJSON(status, export)
+}
+
+func setDataExportDownloadUrl(export *models.DataExport) {
+	if export.Status == models.DataExportComplete && export.ExpiresAt != nil && export.ExpiresAt.After(time.Now()) {
+		export.DownloadUrl = fmt.Sprintf("/account/exports/%d/download", export.DataExportId)
+	}
+}
+
+// runDataExport builds an export's archive in the background and records the outcome. The
+// archive is written to a temporary file in dir and only renamed into place once complete.
+func runDataExport(export models.DataExport, dir string, db *sql.DB) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("data export %d: %v", export.DataExportId, r)
+			database.FailDataExport(export.DataExportId, "internal error", db)
+		}
+	}()
+
+	archivePath, size, err := writeDataExportArchive(export, dir, db)
+	if err != nil {
+		log.Printf("data export %d: %v", export.DataExportId, err)
+		database.FailDataExport(export.DataExportId, "could not read account data", db)
+		return
+	}
+	if err := database.CompleteDataExport(export.DataExportId, archivePath, size, dataExportTTL, db); err != nil {
+		os.Remove(archivePath)
+	}
+}
+
+func writeDataExportArchive(export models.DataExport, dir string, db *sql.DB) (string, int64, error) {
+	f, err := os.CreateTemp(dir, dataExportTempPattern)
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := buildDataExportArchive(export.BankingUserId, f, db); err != nil {
+		return "", 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+
+	archivePath := filepath.Join(dir, fmt.Sprintf("export-%d.zip", export.DataExportId))
+	if err := os.Rename(f.Name(), archivePath); err != nil {
+		return "", 0, err
+	}
+	return archivePath, info.Size(), nil
+}
+
+// RemoveDataExportFiles deletes archive files, ignoring any that are already gone
+func RemoveDataExportFiles(paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Print(err)
+		}
+	}
+}
+
+// RemoveUnfinishedDataExportFiles deletes the temporary files of archives whose build was cut
+// short by a server restart
+func RemoveUnfinishedDataExportFiles(dir string) {
+	paths, err := filepath.Glob(filepath.Join(dir, dataExportTempPattern))
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	RemoveDataExportFiles(paths)
+}
+
+// buildDataExportArchive zips the user's profile (without credentials), institutions, statements
+// and transactions as JSON and CSV, plus their saved settings. manifest.json records the schema
+// version and how many records each file holds. The zip is streamed to w as it is built.
+func buildDataExportArchive(userID int, w io.Writer, db *sql.DB) error {
+	zw := zip.NewWriter(w)
+	manifest := models.DataExportManifest{
+		Format:        dataExportFormat,
+		SchemaVersion: models.DataExportSchemaVersion,
+		BankingUserId: userID,
+		GeneratedAt:   time.Now().UTC(),
+		Counts:        map[string]int{},
+	}
+
+	profile, err := database.GetUserSummary(userID, db)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveJSON(zw, "profile.json", profile); err != nil {
+		return err
+	}
+
+	institutions, err := database.GetInstitutionsByUserId(userID, db)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["institutions"] = len(institutions)
+	if err := writeArchiveJSON(zw, "institutions.json", institutions); err != nil {
+		return err
+	}
+
+	statements, err := database.GetStatementsByUserId(userID, db)
+	if err != nil {
+		return err
+	}
+	if statements == nil {
+		statements = []models.Statement{}
+	}
+	manifest.Counts["statements"] = len(statements)
+	if err := writeArchiveJSON(zw, "statements.json", statements); err != nil {
+		return err
+	}
+	if err := writeStatementsCSV(zw, statements); err != nil {
+		return err
+	}
+
+	count, err := writeTransactionsJSON(zw, userID, db)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["transactions"] = count
+	if err := writeTransactionsCSV(zw, userID, db); err != nil {
+		return err
+	}
+
+	csvMappings, err := database.GetCsvColumnMappingsByUserId(userID, db)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["csv_column_mappings"] = len(csvMappings)
+	if err := writeArchiveJSON(zw, "settings/csv_column_mappings.json", csvMappings); err != nil {
+		return err
+	}
+
+	ledgerMapping, err := database.GetLedgerAccountMappingAuthorized(userID, db)
+	if err == nil {
+		manifest.Counts["ledger_account_mapping"] = 1
+		if err := writeArchiveJSON(zw, "settings/ledger_account_mapping.json", ledgerMapping); err != nil {
+			return err
+		}
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	tokens, err := database.GetPersonalAccessTokensByUserId(userID, db)
+	if err != nil {
+		return err
+	}
+	if tokens == nil {
+		tokens = []models.PersonalAccessToken{}
+	}
+	manifest.Counts["personal_access_tokens"] = len(tokens)
+	if err := writeArchiveJSON(zw, "settings/personal_access_tokens.json", tokens); err != nil {
+		return err
+	}
+
+	identities, err := database.GetUserIdentitiesByUserId(userID, db)
+	if err != nil {
+		return err
+	}
+	manifest.Counts["identities"] = len(identities)
+	if err := writeArchiveJSON(zw, "settings/identities.json", identities); err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(zw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeStatementsCSV(zw *zip.Writer, statements []models.Statement) error {
+	f, err := zw.Create("statements.csv")
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"statement_id", "institution_id", "period_start", "period_end", "date_added"})
+	for _, statement := range statements {
+		w.Write([]string{
+			strconv.Itoa(statement.StatementId),
+			strconv.Itoa(statement.InstitutionId),
+			statement.PeriodStart.Format("2006-01-02"),
+			statement.PeriodEnd.Format("2006-01-02"),
+			statement.DateAdded.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeTransactionsJSON streams transactions.json as one array without holding every
+// transaction in memory, and returns how many it wrote
+func writeTransactionsJSON(zw *zip.Writer, userID int, db *sql.DB) (int, error) {
+	f, err := zw.Create("transactions.json")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	if _, err := f.Write([]byte("[")); err != nil {
+		return 0, err
+	}
+	err = database.StreamTransactionsAuthorized(models.TransactionFilter{}, func(txn models.ExportedTransaction) error {
+		separator := "\n  "
+		if count > 0 {
+			separator = ",\n  "
+		}
+		encoded, err := json.Marshal(txn)
+		if err != nil {
+			return err
+		}
+		count++
+		_, err = f.Write(append([]byte(separator), encoded...))
+		return err
+	}, userID, db)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Write([]byte("\n]\n"))
+	return count, err
+}
+
+func writeTransactionsCSV(zw *zip.Writer, userID int, db *sql.DB) error {
+	f, err := zw.Create("transactions.csv")
+	if err != nil {
+		return err
+	}
+	writer := exporter.NewCSVWriter(f)
+	if err := database.StreamTransactionsAuthorized(models.TransactionFilter{}, writer.Write, userID, db); err != nil {
+		return err
+	}
+	return writer.Close()
+}
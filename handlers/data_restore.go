@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/exporter"
+	"moneyd/api/importer"
+	"moneyd/api/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxRestoreArchiveSize = 512 << 20
+	// restoreChunkSize transactions are decoded and inserted together
+	restoreChunkSize = 10000
+)
+
+// Archive files a restore reads nothing from. Tokens and linked identities are credentials
+// for this account, so they are never recreated from a file.
+var unrestoredArchiveFiles = []string{
+	"settings/personal_access_tokens.json",
+	"settings/identities.json",
+}
+
+// RestoreDataExportHandler recreates the statements, transactions and settings in an uploaded
+// export archive (multipart field "archive") for the authenticated user. The archive must carry
+// the schema version this server writes, and the account must not have any statements yet. The
+// whole restore is one database transaction: it either completes or changes nothing.
+func RestoreDataExportHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		file, header, err := c.Request.FormFile("archive")
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "An archive file is required"})
+			return
+		}
+		defer file.Close()
+		if header.Size > maxRestoreArchiveSize {
+			c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Archive too large"})
+			return
+		}
+
+		archive, err := zip.NewReader(file, header.Size)
+		if err != nil {
+			c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": "File is not a zip archive"})
+			return
+		}
+
+		knownTypes, err := transactionTypeCodes(db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		restore, manifest, err := readDataRestore(archive)
+		if err != nil {
+			respondWithRestoreError(c, err)
+			return
+		}
+		if err := validateRestoredMappings(restore, knownTypes); err != nil {
+			respondWithRestoreError(c, err)
+			return
+		}
+
+		transactions, err := archive.Open("transactions.json")
+		if err != nil {
+			respondWithRestoreError(c, &database.ArchiveError{Reason: "archive has no transactions.json"})
+			return
+		}
+		defer transactions.Close()
+		next, err := archiveTransactions(transactions, manifest.Counts["transactions"], knownTypes)
+		if err != nil {
+			respondWithRestoreError(c, err)
+			return
+		}
+
+		result, err := database.RestoreAccountAuthorized(restore, next, userID, db)
+		if err != nil {
+			respondWithRestoreError(c, err)
+			return
+		}
+
+		for _, name := range unrestoredArchiveFiles {
+			if hasArchiveFile(archive, name) {
+				result.NotRestored = append(result.NotRestored, name)
+			}
+		}
+		c.IndentedJSON(http.StatusCreated, result)
+	}
+}
+
+func respondWithRestoreError(c *gin.Context, err error) {
+	var archiveErr *database.ArchiveError
+	switch {
+	case errors.As(err, &archiveErr):
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"error": "Archive cannot be restored: " + archiveErr.Reason})
+	case errors.Is(err, database.ErrAccountNotEmpty):
+		c.IndentedJSON(http.StatusConflict, gin.H{"error": "Archives can only be restored into an account without statements"})
+	default:
+		log.Print(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// readDataRestore checks an archive's manifest and reads everything but its transactions
+func readDataRestore(archive *zip.Reader) (models.DataRestore, models.DataExportManifest, error) {
+	var restore models.DataRestore
+	var manifest models.DataExportManifest
+
+	if err := readArchiveJSON(archive, "manifest.json", &manifest); err != nil {
+		return restore, manifest, err
+	}
+	if manifest.Format != dataExportFormat {
+		return restore, manifest, &database.ArchiveError{Reason: "manifest.json does not describe a moneyd account export"}
+	}
+	if manifest.SchemaVersion != models.DataExportSchemaVersion {
+		return restore, manifest, &database.ArchiveError{Reason: fmt.Sprintf(
+			"archive has schema version %d but this server restores version %d",
+			manifest.SchemaVersion, models.DataExportSchemaVersion,
+		)}
+	}
+
+	if err := readArchiveJSON(archive, "institutions.json", &restore.Institutions); err != nil {
+		return restore, manifest, err
+	}
+	if err := readArchiveJSON(archive, "statements.json", &restore.Statements); err != nil {
+		return restore, manifest, err
+	}
+	if hasArchiveFile(archive, "settings/csv_column_mappings.json") {
+		if err := readArchiveJSON(archive, "settings/csv_column_mappings.json", &restore.CsvColumnMappings); err != nil {
+			return restore, manifest, err
+		}
+	}
+	if hasArchiveFile(archive, "settings/ledger_account_mapping.json") {
+		restore.LedgerAccountMapping = &models.LedgerAccountMapping{}
+		if err := readArchiveJSON(archive, "settings/ledger_account_mapping.json", restore.LedgerAccountMapping); err != nil {
+			return restore, manifest, err
+		}
+	}
+
+	return restore, manifest, nil
+}
+
+// validateRestoredMappings applies the checks the settings endpoints make to the archive's
+// mappings, so an edited archive cannot store one that breaks later imports or exports
+func validateRestoredMappings(restore models.DataRestore, knownTypes map[int]bool) error {
+	for _, mapping := range restore.CsvColumnMappings {
+		if err := importer.ValidateCsvMapping(mapping); err != nil {
+			return &database.ArchiveError{Reason: fmt.Sprintf("CSV column mapping for institution %d: %v", mapping.InstitutionId, err)}
+		}
+		for _, code := range []int{mapping.DebitTransactionTypeCode, mapping.CreditTransactionTypeCode} {
+			if !knownTypes[code] {
+				return &database.ArchiveError{Reason: fmt.Sprintf("CSV column mapping for institution %d uses transaction type %d, which does not exist on this server", mapping.InstitutionId, code)}
+			}
+		}
+	}
+
+	if mapping := restore.LedgerAccountMapping; mapping != nil {
+		if err := exporter.ValidateLedgerMapping(*mapping); err != nil {
+			return &database.ArchiveError{Reason: "ledger account mapping: " + err.Error()}
+		}
+		for code := range mapping.TransactionTypeAccounts {
+			if !knownTypes[code] {
+				return &database.ArchiveError{Reason: fmt.Sprintf("ledger account mapping names transaction type %d, which does not exist on this server", code)}
+			}
+		}
+	}
+	return nil
+}
+
+// readArchiveJSON decodes one file of the archive
+func readArchiveJSON(archive *zip.Reader, name string, v any) error {
+	f, err := archive.Open(name)
+	if err != nil {
+		return &database.ArchiveError{Reason: "archive has no " + name}
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return &database.ArchiveError{Reason: name + ": " + err.Error()}
+	}
+	return nil
+}
+
+func hasArchiveFile(archive *zip.Reader, name string) bool {
+	_, err := fs.Stat(archive, name)
+	return err == nil
+}
+
+// archiveTransactions decodes transactions.json incrementally, returning restoreChunkSize
+// transactions per call and io.EOF at the end. It fails if the array holds a transaction type
+// this server does not know, or a different number of transactions than the manifest lists.
+func archiveTransactions(r io.Reader, expected int, knownTypes map[int]bool) (func() ([]models.Transaction, error), error) {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, &database.ArchiveError{Reason: "transactions.json is not a JSON array"}
+	}
+
+	count := 0
+	next := func() ([]models.Transaction, error) {
+		var txns []models.Transaction
+		for len(txns) < restoreChunkSize && decoder.More() {
+			var txn models.ExportedTransaction
+			if err := decoder.Decode(&txn); err != nil {
+				return nil, &database.ArchiveError{Reason: fmt.Sprintf("transactions.json: entry %d: %v", count+1, err)}
+			}
+			count++
+			if !knownTypes[txn.TransactionTypeLookupCode] {
+				return nil, &database.ArchiveError{Reason: fmt.Sprintf("transaction %d has transaction_type_lookup_code %d, which does not exist on this server", txn.TransactionId, txn.TransactionTypeLookupCode)}
+			}
+			txns = append(txns, txn.Transaction)
+		}
+		if len(txns) > 0 {
+			return txns, nil
+		}
+
+		if token, err := decoder.Token(); err != nil || token != json.Delim(']') {
+			return nil, &database.ArchiveError{Reason: "transactions.json is truncated"}
+		}
+		if count != expected {
+			return nil, &database.ArchiveError{Reason: fmt.Sprintf("transactions.json holds %d transactions but manifest.json lists %d", count, expected)}
+		}
+		return nil, io.EOF
+	}
+	return next, nil
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/exporter"
+	"moneyd/api/models"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultExportCurrency = "USD"
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var exportExtensions = map[string]string{
+	models.ExportFormatCsv:       "csv",
+	models.ExportFormatOfx:       "ofx",
+	models.ExportFormatLedger:    "ledger",
+	models.ExportFormatHledger:   "journal",
+	models.ExportFormatBeancount: "beancount",
+}
+
+// ExportTransactionsHandler streams the user's transactions as a CSV, OFX, Ledger, hledger or
+// Beancount file, chosen by the "format" query parameter. The transactionFilter parameters narrow
+// the export; OFX also takes a "currency" code, defaulting to USD, while the plain-text accounting
+// formats use the user's ledger account mapping.
+func ExportTransactionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		format := strings.ToLower(c.DefaultQuery("format", models.ExportFormatCsv))
+		if !slices.Contains(models.ExportFormats, format) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error":   "Unknown export format " + format,
+				"formats": models.ExportFormats,
+			})
+			return
+		}
+
+		filter, err := transactionFilter(c)
+		if err != nil {
+			return
+		}
+
+		var writer exporter.Writer
+		contentType := "text/csv; charset=utf-8"
+		switch format {
+		case models.ExportFormatCsv:
+			writer = exporter.NewCSVWriter(c.Writer)
+		case models.ExportFormatOfx:
+			opts, err := ofxOptions(c, filter, userID, db)
+			if err != nil {
+				return
+			}
+			writer = exporter.NewOFXWriter(c.Writer, opts)
+			contentType = "application/x-ofx"
+		default:
+			opts, err := ledgerOptions(format, userID, db)
+			if err != nil {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			writer, err = exporter.NewLedgerWriter(c.Writer, opts)
+			if err != nil {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Saved account mapping is invalid: " + err.Error()})
+				return
+			}
+			contentType = "text/plain; charset=utf-8"
+		}
+
+		// Headers go out with the first row, so a query that fails before then still gets a JSON error
+		started := false
+		start := func() {
+			if started {
+				return
+			}
+			started = true
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="transactions.%s"`, exportExtensions[format]))
+			c.Status(http.StatusOK)
+		}
+
+		err = database.StreamTransactionsAuthorized(filter, func(txn models.ExportedTransaction) error {
+			start()
+			return writer.Write(txn)
+		}, userID, db)
+		if err != nil {
+			if !started {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			// The client has a partial file by now; all that is left is to cut it short
+			log.Print(err)
+			c.Abort()
+			return
+		}
+
+		start()
+		if err := writer.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// transactionFilter reads statement_id, institution_id, transaction_type, from and to
+// (YYYY-MM-DD, inclusive), min_amount and max_amount (cents, inclusive) and search (part of the
+// description) from the query string.
+// It writes the error response itself, so callers only need to return on error.
+func transactionFilter(c *gin.Context) (models.TransactionFilter, error) {
+	var filter models.TransactionFilter
+
+	ids := map[string]*int{
+		"statement_id":     &filter.StatementId,
+		"institution_id":   &filter.InstitutionId,
+		"transaction_type": &filter.TransactionTypeLookupCode,
+	}
+	for name, id := range ids {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return filter, errors.New("invalid " + name)
+		}
+		*id = parsed
+	}
+
+	dates := map[string]**time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	}
+	for name, date := range dates {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " date; use YYYY-MM-DD"})
+			return filter, errors.New("invalid " + name)
+		}
+		*date = &parsed
+	}
+
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "to is before from"})
+		return filter, errors.New("to is before from")
+	}
+
+	amounts := map[string]**int64{
+		"min_amount": &filter.MinAmount,
+		"max_amount": &filter.MaxAmount,
+	}
+	for name, amount := range amounts {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + "; use a whole number of cents"})
+			return filter, errors.New("invalid " + name)
+		}
+		*amount = &parsed
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MaxAmount < *filter.MinAmount {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "max_amount is below min_amount"})
+		return filter, errors.New("max_amount is below min_amount")
+	}
+
+	filter.Search = strings.TrimSpace(c.Query("search"))
+	return filter, nil
+}
+
+// ofxOptions works out the statement period and currency for an OFX export. The period is the
+// requested date range, with open ends taken from the transactions themselves.
+// It writes the error response itself, so callers only need to return on error.
+func ofxOptions(c *gin.Context, filter models.TransactionFilter, userID int, db *sql.DB) (exporter.OFXOptions, error) {
+	opts := exporter.OFXOptions{Currency: strings.ToUpper(c.DefaultQuery("currency", defaultExportCurrency))}
+	if !currencyCode.MatchString(opts.Currency) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "currency must be a three-letter ISO 4217 code"})
+		return opts, errors.New("invalid currency")
+	}
+
+	first, last, err := database.GetTransactionDateRangeAuthorized(filter, userID, db)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return opts, err
+	}
+	opts.Start, opts.End = first, last
+	if filter.From != nil {
+		opts.Start = *filter.From
+	}
+	if filter.To != nil {
+		opts.End = *filter.To
+	}
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+	if opts.End.IsZero() {
+		opts.End = opts.Start
+	}
+
+	if filter.InstitutionId != 0 {
+		institution, err := database.GetInstitution(filter.InstitutionId, db)
+		if err == nil {
+			opts.Institution = institution.Name
+		}
+	}
+	return opts, nil
+}
+
+// ledgerOptions loads the user's account mapping, or an empty one if none is saved, along with the
+// transaction type names used for unmapped types
+func ledgerOptions(format string, userID int, db *sql.DB) (exporter.LedgerOptions, error) {
+	opts := exporter.LedgerOptions{Format: format}
+
+	mapping, err := database.GetLedgerAccountMappingAuthorized(userID, db)
+	if err != nil && err != sql.ErrNoRows {
+		return opts, err
+	}
+	opts.Mapping = mapping
+
+	types, err := database.GetTransactionTypes(db)
+	if err != nil {
+		log.Print(err)
+		return opts, err
+	}
+	opts.TransactionTypes = make(map[int]string, len(types))
+	for _, t := range types {
+		opts.TransactionTypes[t.TransactionTypeLookupCode] = t.Description
+	}
+	return opts, nil
+}
+
+// GetLedgerAccountMappingHandler returns the user's ledger account mapping. A user who has not
+// saved one gets the empty mapping every export falls back to.
+func GetLedgerAccountMappingHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		mapping, err := database.GetLedgerAccountMappingAuthorized(userID, db)
+		if err == sql.ErrNoRows {
+			mapping = models.LedgerAccountMapping{
+				BankingUserId:           userID,
+				Currency:                exporter.DefaultLedgerCurrency,
+				InstitutionAccounts:     map[int]string{},
+				TransactionTypeAccounts: map[int]string{},
+			}
+		} else if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, mapping)
+	}
+}
+
+// SaveLedgerAccountMappingHandler replaces the user's ledger account mapping
+func SaveLedgerAccountMappingHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var mapping models.LedgerAccountMapping
+		if err := c.ShouldBindJSON(&mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := exporter.ValidateLedgerMapping(mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		saved, err := database.SaveLedgerAccountMappingAuthorized(mapping, c.GetInt("user_id"), db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, saved)
+	}
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/importer"
+	"moneyd/api/models"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxImportFileSize = 20 << 20
+
+// importUpload is a parsed upload and where its rows are headed. A zero statement.StatementId
+// means the statement is matched or created from result.Statement when the rows are inserted.
+type importUpload struct {
+	statement     models.Statement
+	institutionId int
+	result        importer.Result
+	mapping       models.CsvColumnMapping
+	saveMapping   bool
+}
+
+// ImportTransactionsHandler accepts a multipart upload of a bank statement export ("file") in the
+// format named by "format" or implied by the file extension: csv, ofx, qfx, qif or camt053 (.xml).
+// QIF dates are read month first unless "day_first=true". Rows are added to the statement given
+// by "statement_id"; without one, the statement for "institution_id" (or the institution the file
+// names) and the file's period is matched or created. CSV column mappings come from the "mapping"
+// field when present, otherwise from the user's saved mapping for the institution;
+// "save_mapping=true" stores a supplied mapping together with the imported rows. Nothing is
+// inserted or saved unless every row is valid, and rows repeating existing transactions are
+// handled by the "duplicates" policy (skip, flag or fail). With "preview=true" nothing is
+// inserted or saved at all; the parsed rows, their errors, likely duplicates and any mapping to
+// save are stored as an import preview instead, and the mapping is saved when it is committed.
+func ImportTransactionsHandler(db *sql.DB, defaultPolicy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+
+		upload, err := parseImportUpload(c, userID, db)
+		if err != nil {
+			return
+		}
+		policy, err := duplicatePolicy(c, defaultPolicy)
+		if err != nil {
+			return
+		}
+
+		institutionIds := make([]int, len(upload.result.Transactions))
+		for i := range institutionIds {
+			institutionIds[i] = upload.institutionId
+		}
+		rows, rowErrors, err := validateImportRows(upload.result.Transactions, upload.result.Rows, institutionIds, userID, db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		rowErrors = mergeRowErrors(upload.result.Errors, rowErrors)
+
+		if c.PostForm("preview") == "true" {
+			var mapping *models.CsvColumnMapping
+			if upload.saveMapping && len(upload.result.Errors) == 0 {
+				mapping = &upload.mapping
+				mapping.InstitutionId = upload.institutionId
+			}
+			if upload.statement.StatementId == 0 {
+				upload.statement = upload.result.Statement
+				upload.statement.BankingUserId = userID
+				upload.statement.InstitutionId = upload.institutionId
+			}
+			respondWithImportPreview(c, &upload.statement, mapping, rows, rowErrors, userID, db)
+			return
+		}
+
+		if len(rowErrors) > 0 {
+			c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "Some rows could not be imported",
+				"errors": rowErrors,
+			})
+			return
+		}
+		if len(rows) == 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "File contains no transactions"})
+			return
+		}
+
+		statement := upload.statement
+		if statement.StatementId == 0 {
+			statement = upload.result.Statement
+			statement.InstitutionId = upload.institutionId
+		}
+
+		txns := make([]models.Transaction, len(rows))
+		sourceRows := make([]int, len(rows))
+		for i, row := range rows {
+			txns[i] = row.Transaction
+			sourceRows[i] = row.Row
+		}
+
+		var mapping *models.CsvColumnMapping
+		if upload.saveMapping {
+			mapping = &upload.mapping
+			mapping.InstitutionId = upload.institutionId
+		}
+
+		result, err := database.ImportTransactionsAuthorized(&statement, txns, mapping, policy, userID, db)
+		if err != nil {
+			var duplicateErr *database.DuplicateTransactionsError
+			if errors.As(err, &duplicateErr) {
+				renumberDuplicateRows(duplicateErr.Rows, sourceRows)
+			}
+			respondWithBatchError(c, err)
+			return
+		}
+		renumberDuplicateRows(result.Skipped, sourceRows)
+		renumberDuplicateRows(result.Flagged, sourceRows)
+
+		c.IndentedJSON(http.StatusCreated, gin.H{
+			"statement":    statement,
+			"transactions": result.Transactions,
+			"skipped":      result.Skipped,
+			"flagged":      result.Flagged,
+			"chunks":       result.Chunks,
+		})
+	}
+}
+
+// parseImportUpload reads the multipart form of an import and parses the uploaded file.
+// It writes the error response itself, so callers only need to return on error.
+func parseImportUpload(c *gin.Context, userID int, db *sql.DB) (importUpload, error) {
+	var upload importUpload
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "A file upload is required"})
+		return upload, err
+	}
+
+	format := importFormat(c.PostForm("format"), fileHeader.Filename)
+	if format == "" {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Unsupported import format", "formats": importFormats})
+		return upload, errors.New("unsupported import format")
+	}
+
+	if raw := c.PostForm("statement_id"); raw != "" {
+		statementId, err := strconv.Atoi(raw)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid statement ID"})
+			return upload, err
+		}
+		upload.statement, err = database.GetStatementAuthorized(statementId, userID, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Resource not found or access denied"})
+			} else {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return upload, err
+		}
+		upload.institutionId = upload.statement.InstitutionId
+	} else if raw := c.PostForm("institution_id"); raw != "" {
+		if upload.institutionId, err = strconv.Atoi(raw); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid institution ID"})
+			return upload, err
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Print(err)
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Could not read uploaded file"})
+		return upload, err
+	}
+	defer file.Close()
+
+	switch format {
+	case "csv":
+		if upload.institutionId == 0 {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "statement_id or institution_id is required for CSV imports"})
+			return upload, errors.New("missing institution")
+		}
+		var supplied bool
+		if upload.mapping, supplied, err = importMapping(c, upload.institutionId, userID, db); err != nil {
+			return upload, err
+		}
+		upload.saveMapping = supplied && c.PostForm("save_mapping") == "true"
+		upload.result, err = importer.ParseCSV(file, upload.mapping)
+	case "ofx":
+		upload.result, err = importer.ParseOFX(file)
+	case "qif":
+		upload.result, err = importer.ParseQIF(file, importer.Options{DayFirstDates: c.PostForm("day_first") == "true"})
+	case "camt053":
+		upload.result, err = importer.ParseCAMT053(file)
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return upload, err
+	}
+
+	if upload.institutionId == 0 && upload.result.InstitutionName != "" {
+		institution, err := database.GetInstitutionByName(upload.result.InstitutionName, db)
+		if err != nil && err != sql.ErrNoRows {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return upload, err
+		}
+		upload.institutionId = institution.InstitutionId
+	}
+	if upload.institutionId == 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "institution_id is required because the file does not name a known institution"})
+		return upload, errors.New("missing institution")
+	}
+
+	opts, err := importOptions(c, upload.institutionId, userID, db)
+	if err != nil {
+		return upload, err
+	}
+	upload.result.ApplyOptions(opts)
+
+	return upload, nil
+}
+
+var importFormats = []string{"csv", "ofx", "qfx", "qif", "camt053"}
+
+// importFormat normalises the requested format, falling back to the upload's file extension
+func importFormat(requested string, filename string) string {
+	format := strings.ToLower(strings.TrimSpace(requested))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case "csv":
+		return "csv"
+	case "ofx", "qfx":
+		return "ofx"
+	case "qif":
+		return "qif"
+	case "camt053", "camt.053", "xml":
+		return "camt053"
+	}
+	return ""
+}
+
+// importOptions reads the transaction type codes for formats that only know whether money went in
+// or out. Codes in the request win; otherwise the institution's saved CSV mapping supplies them.
+// It writes the error response itself, so callers only need to return on error.
+func importOptions(c *gin.Context, institutionId int, userID int, db *sql.DB) (importer.Options, error) {
+	var opts importer.Options
+	for field, code := range map[string]*int{
+		"debit_transaction_type_code":  &opts.DebitTransactionTypeCode,
+		"credit_transaction_type_code": &opts.CreditTransactionTypeCode,
+	} {
+		if raw := c.PostForm(field); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field})
+				return opts, err
+			}
+			*code = value
+		}
+	}
+
+	if opts.DebitTransactionTypeCode == 0 || opts.CreditTransactionTypeCode == 0 {
+		mapping, err := database.GetCsvColumnMappingAuthorized(institutionId, userID, db)
+		if err != nil && err != sql.ErrNoRows {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return opts, err
+		}
+		if opts.DebitTransactionTypeCode == 0 {
+			opts.DebitTransactionTypeCode = mapping.DebitTransactionTypeCode
+		}
+		if opts.CreditTransactionTypeCode == 0 {
+			opts.CreditTransactionTypeCode = mapping.CreditTransactionTypeCode
+		}
+	}
+	return opts, nil
+}
+
+// importMapping picks the column mapping for an upload and reports whether it came from the
+// request. It writes the error response itself, so callers only need to return on error.
+func importMapping(c *gin.Context, institutionId int, userID int, db *sql.DB) (models.CsvColumnMapping, bool, error) {
+	var mapping models.CsvColumnMapping
+
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping"})
+			return mapping, true, err
+		}
+		if err := importer.ValidateCsvMapping(mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return mapping, true, err
+		}
+		return mapping, true, nil
+	}
+
+	mapping, err := database.GetCsvColumnMappingAuthorized(institutionId, userID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "No CSV column mapping is saved for this institution; send one in the mapping field"})
+		} else {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return mapping, false, err
+	}
+	return mapping, false, nil
+}
+
+// SaveCsvColumnMappingHandler stores the authenticated user's CSV column mapping for the
+// institution in the :id route parameter
+func SaveCsvColumnMappingHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		institutionId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		var mapping models.CsvColumnMapping
+		if err := c.ShouldBindJSON(&mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := importer.ValidateCsvMapping(mapping); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		saved, err := database.SaveCsvColumnMappingAuthorized(institutionId, mapping, c.GetInt("user_id"), db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, saved)
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const importPreviewTTL = 24 * time.Hour
+
+// validateImportRows checks parsed transactions against the database and flags likely duplicates.
+// sourceRows and institutionIds run parallel to txns; sourceRows numbers the rows for errors.
+func validateImportRows(txns []models.Transaction, sourceRows []int, institutionIds []int, userID int, db *sql.DB) ([]models.ImportRow, []models.ImportRowError, error) {
+	knownTypes, err := transactionTypeCodes(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	duplicates, err := database.FindLikelyDuplicatesAuthorized(txns, institutionIds, userID, db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	for i, txn := range txns {
+		if reason := importRowProblem(txn, knownTypes); reason != "" {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: sourceRows[i], Reason: reason})
+			continue
+		}
+
+		rows = append(rows, models.ImportRow{
+			Row:         sourceRows[i],
+			Transaction: txn,
+			DuplicateOf: duplicates[i],
+		})
+	}
+
+	return rows, rowErrors, nil
+}
+
+// transactionTypeCodes returns the set of valid transaction_type_lookup_code values
+func transactionTypeCodes(db *sql.DB) (map[int]bool, error) {
+	types, err := database.GetTransactionTypes(db)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	knownTypes := make(map[int]bool, len(types))
+	for _, t := range types {
+		knownTypes[t.TransactionTypeLookupCode] = true
+	}
+	return knownTypes, nil
+}
+
+// importRowProblem explains why a transaction cannot be inserted, or returns "" if it can
+func importRowProblem(txn models.Transaction, knownTypes map[int]bool) string {
+	switch {
+	case txn.TransactionDate.IsZero():
+		return "transaction_date is missing"
+	case strings.TrimSpace(txn.Description) == "":
+		return "description is empty"
+	case txn.TransactionTypeLookupCode == 0:
+		return "transaction_type_lookup_code is missing; send debit_transaction_type_code and credit_transaction_type_code"
+	case !knownTypes[txn.TransactionTypeLookupCode]:
+		return fmt.Sprintf("transaction_type_lookup_code %d does not exist", txn.TransactionTypeLookupCode)
+	}
+	return ""
+}
+
+// mergeRowErrors combines parse and validation errors in row order
+func mergeRowErrors(parseErrors []models.ImportRowError, validationErrors []models.ImportRowError) []models.ImportRowError {
+	merged := append(slices.Clone(parseErrors), validationErrors...)
+	slices.SortStableFunc(merged, func(a, b models.ImportRowError) int {
+		return cmp.Compare(a.Row, b.Row)
+	})
+	return merged
+}
+
+func respondWithImportPreview(c *gin.Context, statement *models.Statement, mapping *models.CsvColumnMapping, rows []models.ImportRow, rowErrors []models.ImportRowError, userID int, db *sql.DB) {
+	preview := models.ImportPreview{
+		BankingUserId:    userID,
+		Statement:        statement,
+		CsvColumnMapping: mapping,
+		Rows:             rows,
+		Errors:           rowErrors,
+	}
+	if preview.Rows == nil {
+		preview.Rows = []models.ImportRow{}
+	}
+	if preview.Errors == nil {
+		preview.Errors = []models.ImportRowError{}
+	}
+
+	created, err := database.CreateImportPreview(preview, importPreviewTTL, db)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, created)
+}
+
+// PreviewTransactionsBatchHandler validates the same JSON body as POST /transactions/batch without
+// inserting it, and stores the result as an import preview. Rows are numbered from 1 in body order.
+func PreviewTransactionsBatchHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		var txns []models.Transaction
+		if err := c.BindJSON(&txns); err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		statements, err := database.GetStatementsByUserId(userID, db)
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		institutionOf := make(map[int]int, len(statements))
+		for _, statement := range statements {
+			institutionOf[statement.StatementId] = statement.InstitutionId
+		}
+
+		var owned []models.Transaction
+		var sourceRows, institutionIds []int
+		var rowErrors []models.ImportRowError
+		for i, txn := range txns {
+			institutionId, ok := institutionOf[txn.StatementId]
+			if !ok {
+				rowErrors = append(rowErrors, models.ImportRowError{
+					Row:    i + 1,
+					Reason: fmt.Sprintf("statement %d not found or access denied", txn.StatementId),
+				})
+				continue
+			}
+			owned = append(owned, txn)
+			sourceRows = append(sourceRows, i+1)
+			institutionIds = append(institutionIds, institutionId)
+		}
+
+		rows, validationErrors, err := validateImportRows(owned, sourceRows, institutionIds, userID, db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		respondWithImportPreview(c, nil, nil, rows, mergeRowErrors(rowErrors, validationErrors), userID, db)
+	}
+}
+
+// CommitImportPreviewHandler inserts the valid rows of a preview. Rows that failed validation are
+// left out and reported back as invalid; duplicates are checked again and handled by the
+// "duplicates" policy. The statement, the rows and any CSV column mapping the upload asked to save
+// are stored in one transaction, so a failed commit leaves none of them behind. A preview can only
+// be committed once, and not after it expires.
+func CommitImportPreviewHandler(db *sql.DB, defaultPolicy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		policy, err := duplicatePolicy(c, defaultPolicy)
+		if err != nil {
+			return
+		}
+
+		previewId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		preview, err := database.ClaimImportPreviewAuthorized(previewId, userID, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Import preview not found, expired or already committed"})
+			} else {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		result, statement, err := commitImportPreview(preview, policy, userID, db)
+		if err != nil {
+			database.ReleaseImportPreview(preview.ImportPreviewId, db)
+			if err == errEmptyImport {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Import preview has no valid rows"})
+			} else {
+				respondWithBatchError(c, err)
+			}
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, gin.H{
+			"statement":    statement,
+			"transactions": result.Transactions,
+			"skipped":      result.Skipped,
+			"flagged":      result.Flagged,
+			"chunks":       result.Chunks,
+			"invalid":      preview.Errors,
+		})
+	}
+}
+
+var errEmptyImport = errors.New("import has no valid rows")
+
+func commitImportPreview(preview models.ImportPreview, policy string, userID int, db *sql.DB) (models.TransactionBatchResult, *models.Statement, error) {
+	var result models.TransactionBatchResult
+	if len(preview.Rows) == 0 {
+		return result, nil, errEmptyImport
+	}
+
+	txns := make([]models.Transaction, len(preview.Rows))
+	sourceRows := make([]int, len(preview.Rows))
+	for i, row := range preview.Rows {
+		txns[i] = row.Transaction
+		sourceRows[i] = row.Row
+	}
+
+	result, err := database.ImportTransactionsAuthorized(preview.Statement, txns, preview.CsvColumnMapping, policy, userID, db)
+	if err != nil {
+		var duplicateErr *database.DuplicateTransactionsError
+		if errors.As(err, &duplicateErr) {
+			renumberDuplicateRows(duplicateErr.Rows, sourceRows)
+		}
+		return result, nil, err
+	}
+	renumberDuplicateRows(result.Skipped, sourceRows)
+	renumberDuplicateRows(result.Flagged, sourceRows)
+
+	return result, preview.Statement, nil
+}
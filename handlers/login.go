@@ -2,15 +2,11 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
-	"time"
 	"database/sql"
-	"os"
-	"github.com/joho/godotenv"
 	"moneyd/api/database"
+	"moneyd/api/keyring"
 	"moneyd/api/utils"
 )
 
@@ -31,12 +27,16 @@ func HashTest() gin.HandlerFunc {
 			return
 		}
 
-		hashed := utils.PasswordHasher(pass.Password);
+		hashed, err := utils.HashPassword(pass.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{ "hashed": hashed })
 	}
 }
 
-func LoginHandler(db *sql.DB) gin.HandlerFunc {
+func LoginHandler(db *sql.DB, keys *keyring.KeyRing) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var loginRequest struct {
 			Email    string `json:"email" binding:"required,email"`
@@ -48,49 +48,102 @@ func LoginHandler(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		accountKey := accountThrottleKey(loginRequest.Email)
+		ipKey := ipThrottleKey(c.ClientIP())
+		if rejectIfLocked(c, []string{accountKey, ipKey}, db) {
+			return
+		}
+
 		user, err := database.GetUserByEmail(loginRequest.Email, db)
-		log.Print(user);
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 			return
 		}
 
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginRequest.Password)); err != nil {
-			log.Printf("Password comparison failed with error: %v", err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		// Unknown emails still pay for hash comparisons and get the same answer as a wrong password
+		passwordHash := ""
+		if err == nil {
+			passwordHash = user.PasswordHash
+		}
+		match, needsRehash, verifyErr := verifyLoginPassword(loginRequest.Password, passwordHash)
+		if verifyErr != nil {
+			log.Printf("Password verification failed with error: %v", verifyErr)
+		}
+		if !match || err != nil {
+			accountThrottle.recordFailure(accountKey, db)
+			ipThrottle.recordFailure(ipKey, db)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": user.BankingUserId,
-			"exp":     time.Now().Add(time.Hour * 24).Unix(),
-		})
+		database.ClearLoginThrottle(accountKey, db)
 
-		enverr := godotenv.Load()
-		if enverr != nil {
-			log.Print(enverr)
-			log.Fatal("Error loading env vars.")
+		// Legacy bcrypt hashes and hashes made with older argon2 settings are upgraded while
+		// the plaintext is at hand. A failure here shouldn't block the login.
+		if needsRehash {
+			if err := database.UpdateUserPassword(user.BankingUserId, loginRequest.Password, db); err != nil {
+				log.Print(err)
+			}
 		}
 
-		// In production, this should be an environment variable
-		expectedJwtSecret := os.Getenv("JWT_SECRET")
+		completeLogin(c, user, db, keys)
+	}
+
+}
+
+// completeLogin finishes any first-factor login: users with a second factor get a challenge,
+// everyone else gets a session straight away
+func completeLogin(c *gin.Context, user database.User, db *sql.DB, keys *keyring.KeyRing) {
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+		return
+	}
+
+	mfa, err := database.GetUserMfa(user.BankingUserId, db)
+	if err != nil && err != sql.ErrNoRows {
+		log.Print(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
-		tokenString, err := token.SignedString([]byte(expectedJwtSecret))
+	// With a second factor enabled the first factor only earns a short-lived challenge token,
+	// which /auth/mfa/verify exchanges for a real session once a code is supplied
+	if err == nil && mfa.EnabledAt.Valid {
+		challenge, err := signMfaChallenge(keys, user.BankingUserId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 			return
 		}
-
-		userResponse := UserResponse{
-			Id:       user.BankingUserId,
-			Email:    user.Email,
-			Username: user.Username,
-		}
-
 		c.JSON(http.StatusOK, gin.H{
-			"token": tokenString,
-			"user":  userResponse,
+			"mfa_required": true,
+			"mfa_token":    challenge,
+			"expires_in":   int(mfaChallengeTTL.Seconds()),
 		})
+		return
+	}
+
+	respondWithSession(c, user, db, keys)
+}
+
+// respondWithSession starts a session for a fully authenticated user and writes the login response
+func respondWithSession(c *gin.Context, user database.User, db *sql.DB, keys *keyring.KeyRing) {
+	tokens, err := startSession(c, user, db, keys)
+	if err != nil {
+		log.Print(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	userResponse := UserResponse{
+		Id:       user.BankingUserId,
+		Email:    user.Email,
+		Username: user.Username,
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.Token,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"user":          userResponse,
+	})
 }
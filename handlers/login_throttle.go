@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttlePolicy locks a key once it reaches threshold failures, doubling the lockout for
+// every failure after that up to maxLockout
+type throttlePolicy struct {
+	threshold   int
+	baseLockout time.Duration
+	maxLockout  time.Duration
+	window      time.Duration
+}
+
+var (
+	// Accounts lock quickly since a real user rarely mistypes a password five times in a row
+	accountThrottle = throttlePolicy{threshold: 5, baseLockout: 30 * time.Second, maxLockout: time.Hour, window: 24 * time.Hour}
+	// Clients get more slack because several people can share an address behind NAT
+	ipThrottle = throttlePolicy{threshold: 20, baseLockout: time.Minute, maxLockout: time.Hour, window: 24 * time.Hour}
+	// Every reset request sends an email, so these count requests rather than failures and only
+	// start over after an hour without one
+	resetAccountThrottle = throttlePolicy{threshold: 3, baseLockout: 15 * time.Minute, maxLockout: 24 * time.Hour, window: time.Hour}
+	resetIpThrottle      = throttlePolicy{threshold: 10, baseLockout: 15 * time.Minute, maxLockout: 24 * time.Hour, window: time.Hour}
+)
+
+// dummyPasswordHashes are an argon2id and a bcrypt hash (at the cost legacy hashes were made
+// with) of a password nobody has. They are built on first use so the argon2id one picks up the
+// configured parameters.
+var dummyPasswordHashes = sync.OnceValues(func() (string, string) {
+	argon2Hash, err := utils.HashPassword("moneyd-dummy-password")
+	if err != nil {
+		log.Print(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("moneyd-dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		log.Print(err)
+	}
+	return argon2Hash, string(bcryptHash)
+})
+
+// verifyLoginPassword checks a login attempt against passwordHash, or against a dummy hash when
+// the email is unknown (passwordHash is empty). Every call pays for one argon2id and one bcrypt
+// comparison, so response times reveal neither whether the account exists nor whether its
+// hash has been upgraded from bcrypt yet.
+func verifyLoginPassword(password string, passwordHash string) (match bool, needsRehash bool, err error) {
+	argon2Hash, bcryptHash := dummyPasswordHashes()
+	if passwordHash == "" {
+		passwordHash = argon2Hash
+	}
+
+	match, needsRehash, err = utils.VerifyPassword(password, passwordHash)
+	if utils.IsBcryptHash(passwordHash) {
+		utils.VerifyPassword(password, argon2Hash)
+	} else {
+		utils.VerifyPassword(password, bcryptHash)
+	}
+	return match, needsRehash, err
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// resetThrottleKey keeps password reset requests from counting against login attempts for
+// the same email or address
+func resetThrottleKey(key string) string {
+	return "reset:" + key
+}
+
+func mfaThrottleKey(userID int) string {
+	return "mfa:" + strconv.Itoa(userID)
+}
+
+func (p throttlePolicy) lockoutFor(failedCount int) time.Duration {
+	if failedCount < p.threshold {
+		return 0
+	}
+	lockout := p.baseLockout
+	for i := p.threshold; i < failedCount && lockout < p.maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.maxLockout)
+}
+
+// recordFailure counts a failed attempt against key and locks it if the policy says so
+func (p throttlePolicy) recordFailure(key string, db *sql.DB) {
+	failedCount, err := database.RecordLoginFailure(key, p.window, db)
+	if err != nil {
+		return
+	}
+	if lockout := p.lockoutFor(failedCount); lockout > 0 {
+		log.Printf("Locking %s for %s after %d failed attempts", key, lockout, failedCount)
+		database.LockLogin(key, lockout, db)
+	}
+}
+
+// rejectIfLocked answers 429 and returns true when any of keys is currently locked out
+func rejectIfLocked(c *gin.Context, keys []string, db *sql.DB) bool {
+	retryAfter, err := database.GetLoginLockout(keys, db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return true
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return true
+	}
+	return false
+}
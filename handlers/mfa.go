@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/keyring"
+	"moneyd/api/utils"
+	"net/http"
+	"time"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaAudience       = "moneyd-mfa"
+	totpIssuer        = "moneyd"
+	recoveryCodeCount = 10
+)
+
+type secondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// signMfaChallenge mints the token LoginHandler hands out in place of a session when a second
+// factor is required. Its audience marks it as a challenge, which AuthMiddleware rejects even
+// though it is signed with the same keys as access tokens.
+func signMfaChallenge(keys *keyring.KeyRing, userID int) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"aud":     mfaAudience,
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+func parseMfaChallenge(keys *keyring.KeyRing, tokenString string) (int, error) {
+	claims, err := keys.Parse(tokenString)
+	if err != nil || !claims.VerifyAudience(mfaAudience, true) {
+		return 0, fmt.Errorf("invalid challenge token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid challenge token")
+	}
+	return int(userID), nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func verifySecondFactor(mfa database.UserMfa, request secondFactorRequest, db *sql.DB) (bool, error) {
+	if request.Code != "" {
+		step, ok := utils.ValidateTotp(mfa.TotpSecret, request.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		err := database.ConsumeTotpStep(mfa.BankingUserId, step, db)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	if request.RecoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(request.RecoveryCode))
+		err := database.UseRecoveryCode(mfa.BankingUserId, hash, db)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes returns codes to show the user once, along with the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// TotpEnrollHandler generates a new TOTP secret for the authenticated user. The secret
+// is not enforced until it is confirmed with a valid code.
+func TotpEnrollHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		user, err := database.GetUser(userID, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+
+		secret, err := utils.GenerateTotpSecret()
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+
+		if _, err := database.StartTotpEnrollment(userID, secret, db); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TotpURI(totpIssuer, user.Email, secret),
+		})
+	}
+}
+
+// TotpConfirmHandler enables a pending enrollment once the user proves their authenticator
+// produces matching codes, and returns a fresh set of recovery codes exactly once
+func TotpConfirmHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var confirmRequest struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&confirmRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		userID := c.GetInt("user_id")
+		mfa, err := database.GetUserMfa(userID, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No pending enrollment"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+		if mfa.EnabledAt.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		step, ok := utils.ValidateTotp(mfa.TotpSecret, confirmRequest.Code, time.Now())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+		if err := database.ConfirmTotpEnrollment(userID, step, hashes, db); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// TotpDisableHandler turns off the second factor after checking a code or recovery code
+func TotpDisableHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var disableRequest secondFactorRequest
+		if err := c.ShouldBindJSON(&disableRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		userID := c.GetInt("user_id")
+		mfa, err := database.GetUserMfa(userID, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Two-factor authentication is not enabled"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		// A pending enrollment was never enforced, so it can be dropped without a code
+		if mfa.EnabledAt.Valid {
+			ok, err := verifySecondFactor(mfa, disableRequest, db)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+				return
+			}
+		}
+
+		if err := database.DisableMfa(userID, db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// MfaVerifyHandler exchanges the challenge token from LoginHandler plus a valid second factor
+// for the same session tokens a password-only login would have received
+func MfaVerifyHandler(db *sql.DB, keys *keyring.KeyRing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var verifyRequest struct {
+			MfaToken string `json:"mfa_token" binding:"required"`
+			secondFactorRequest
+		}
+
+		if err := c.ShouldBindJSON(&verifyRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		userID, err := parseMfaChallenge(keys, verifyRequest.MfaToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+
+		// Six digits are quick to guess without a limit, so codes share the login lockout rules
+		mfaKey := mfaThrottleKey(userID)
+		if rejectIfLocked(c, []string{mfaKey}, db) {
+			return
+		}
+
+		mfa, err := database.GetUserMfa(userID, db)
+		if err != nil || !mfa.EnabledAt.Valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+			return
+		}
+
+		ok, err := verifySecondFactor(mfa, verifyRequest.secondFactorRequest, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !ok {
+			accountThrottle.recordFailure(mfaKey, db)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		database.ClearLoginThrottle(mfaKey, db)
+
+		user, err := database.GetUser(userID, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if user.DisabledAt != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account disabled"})
+			return
+		}
+
+		respondWithSession(c, user, db, keys)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/keyring"
+	"moneyd/api/oidc"
+	"moneyd/api/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const oidcLoginTTL = 10 * time.Minute
+
+// OidcStartHandler begins an authorization code + PKCE login. The client sends the browser to
+// authorization_url and, once the provider redirects back, posts the code and state to the callback.
+func OidcStartHandler(db *sql.DB, provider *oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		nonce, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		codeVerifier, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		authorizationURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, codeVerifier)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+			return
+		}
+
+		if err := database.CreateOidcLoginState(utils.HashToken(state), codeVerifier, nonce, oidcLoginTTL, db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"authorization_url": authorizationURL,
+			"state":             state,
+		})
+	}
+}
+
+// OidcCallbackHandler redeems the authorization code, resolves the local user for the
+// provider's subject and then finishes the login exactly like a password login would
+func OidcCallbackHandler(db *sql.DB, keys *keyring.KeyRing, provider *oidc.Provider, allowSignup bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var callbackRequest struct {
+			Code  string `json:"code" binding:"required"`
+			State string `json:"state" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&callbackRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		codeVerifier, nonce, err := database.ConsumeOidcLoginState(utils.HashToken(callbackRequest.State), db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired login state"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		claims, err := provider.Exchange(c.Request.Context(), callbackRequest.Code, codeVerifier, nonce)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider login failed"})
+			return
+		}
+
+		user, err := database.GetUserByIdentity(provider.Issuer(), claims.Subject, db)
+		if err == nil {
+			completeLogin(c, user, db, keys)
+			return
+		}
+		if err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		identity := database.UserIdentity{
+			Issuer:  provider.Issuer(),
+			Subject: claims.Subject,
+			Email:   claims.Email,
+		}
+
+		// Our provider is trusted to vouch for email ownership, so a verified address links the
+		// identity to the existing account with that email on first use
+		if claims.Email != "" && claims.EmailVerified {
+			user, err := database.GetUserByEmail(claims.Email, db)
+			if err == nil {
+				identity.BankingUserId = user.BankingUserId
+				if _, err := database.CreateUserIdentity(identity, db); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+					return
+				}
+				completeLogin(c, user, db, keys)
+				return
+			}
+			if err != sql.ErrNoRows {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+		}
+
+		if !allowSignup || claims.Email == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "No account is linked to this identity"})
+			return
+		}
+
+		username := claims.PreferredUsername
+		if username == "" {
+			username, _, _ = strings.Cut(claims.Email, "@")
+		}
+
+		newUser := database.User{}
+		newUser.Username = username
+		newUser.Email = claims.Email
+		user, err = database.CreateUserWithIdentity(newUser, identity, claims.EmailVerified, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+
+		completeLogin(c, user, db, keys)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/models"
+	"moneyd/api/utils"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CreatePersonalAccessTokenHandler mints a new token for the authenticated user. The plaintext
+// token is only ever returned in this response.
+func CreatePersonalAccessTokenHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var createRequest struct {
+			Name          string   `json:"name" binding:"required"`
+			Scopes        []string `json:"scopes" binding:"required,min=1"`
+			ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+		}
+
+		if err := c.ShouldBindJSON(&createRequest); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		for _, scope := range createRequest.Scopes {
+			if !slices.Contains(models.GrantableScopes, scope) {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{
+					"error":            "Unknown scope " + scope,
+					"grantable_scopes": models.GrantableScopes,
+				})
+				return
+			}
+		}
+
+		secret, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		token := models.PersonalAccessTokenPrefix + secret
+
+		pat := database.PersonalAccessToken{
+			BankingUserId: c.GetInt("user_id"),
+			Name:          strings.TrimSpace(createRequest.Name),
+			TokenHash:     utils.HashToken(token),
+			TokenPrefix:   token[:len(models.PersonalAccessTokenPrefix)+6],
+			Scopes:        slices.Compact(slices.Sorted(slices.Values(createRequest.Scopes))),
+		}
+
+		created, err := database.CreatePersonalAccessToken(pat, createRequest.ExpiresInDays, db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, gin.H{
+			"token":                 token,
+			"personal_access_token": created,
+		})
+	}
+}
+
+// ListPersonalAccessTokensHandler lists the authenticated user's tokens without their secrets
+func ListPersonalAccessTokensHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		pats, err := database.GetPersonalAccessTokensByUserId(c.GetInt("user_id"), db)
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, pats)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/keyring"
+	"moneyd/api/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func signAccessToken(keys *keyring.KeyRing, userID int, sessionID int, role string) (string, error) {
+	return keys.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"sid":     sessionID,
+		"role":    role,
+		"exp":     time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+// startSession records a new server-side session for the user and mints its first token pair
+func startSession(c *gin.Context, user database.User, db *sql.DB, keys *keyring.KeyRing) (TokenPair, error) {
+	refreshToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	session, err := database.CreateSession(user.BankingUserId, utils.HashToken(refreshToken), c.Request.UserAgent(), c.ClientIP(), refreshTokenTTL, db)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	accessToken, err := signAccessToken(keys, user.BankingUserId, session.AuthSessionId, user.Role)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshHandler exchanges a refresh token for a new access token, rotating the refresh token
+func RefreshHandler(db *sql.DB, keys *keyring.KeyRing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refreshRequest struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&refreshRequest); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		newRefreshToken, err := utils.GenerateToken(32)
+		if err != nil {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		session, err := database.RotateSession(utils.HashToken(refreshRequest.RefreshToken), utils.HashToken(newRefreshToken), c.Request.UserAgent(), c.ClientIP(), refreshTokenTTL, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		// Role and account status are re-read on every refresh so admin changes reach the next access token
+		user, err := database.GetUser(session.BankingUserId, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+			return
+		}
+		if user.DisabledAt != nil {
+			database.RevokeSessionAuthorized(session.AuthSessionId, user.BankingUserId, db)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account disabled"})
+			return
+		}
+
+		accessToken, err := signAccessToken(keys, user.BankingUserId, session.AuthSessionId, user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, TokenPair{
+			Token:        accessToken,
+			RefreshToken: newRefreshToken,
+			ExpiresIn:    int(accessTokenTTL.Seconds()),
+		})
+	}
+}
+
+// LogoutHandler revokes the session the current access token was issued for
+func LogoutHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		sessionID := c.GetInt("session_id")
+
+		if _, err := database.RevokeSessionAuthorized(sessionID, userID, db); err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ListSessionsHandler returns the authenticated user's active sessions, flagging the one making the request
+func ListSessionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		currentSessionID := c.GetInt("session_id")
+
+		sessions, err := database.GetActiveSessionsByUserId(userID, db)
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].AuthSessionId == currentSessionID
+		}
+
+		c.IndentedJSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSessionHandler revokes one of the authenticated user's sessions by ID
+func RevokeSessionHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+
+		userID := c.GetInt("user_id")
+		if _, err := database.RevokeSessionAuthorized(sessionID, userID, db); err != nil {
+			if err == sql.ErrNoRows {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"error": "Resource not found or access denied"})
+			} else {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RevokeAllSessionsHandler logs the authenticated user out everywhere, including the current session
+func RevokeAllSessionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		revoked, err := database.RevokeAllSessionsAuthorized(userID, db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, gin.H{"revoked": revoked})
+	}
+}
+
+// JWKSHandler publishes the public keys access tokens can be verified with
+func JWKSHandler(keys *keyring.KeyRing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.JWKS())
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/models"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTransactionsBatchHandler inserts a JSON array of transactions, handling rows that repeat
+// existing transactions according to the "duplicates" query parameter (skip, flag or fail),
+// which defaults to defaultPolicy
+func CreateTransactionsBatchHandler(db *sql.DB, defaultPolicy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, err := duplicatePolicy(c, defaultPolicy)
+		if err != nil {
+			return
+		}
+
+		var txns []models.Transaction
+		if err := c.BindJSON(&txns); err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+
+		result, err := database.CreateTransactionsBatchWithPolicyAuthorized(txns, policy, c.GetInt("user_id"), db)
+		if err != nil {
+			respondWithBatchError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, result)
+	}
+}
+
+// duplicatePolicy reads the duplicate policy from the query string or, for uploads, the form.
+// It writes the error response itself, so callers only need to return on error.
+func duplicatePolicy(c *gin.Context, defaultPolicy string) (string, error) {
+	policy := c.Query("duplicates")
+	if policy == "" {
+		policy = c.PostForm("duplicates")
+	}
+	if policy == "" {
+		policy = defaultPolicy
+	}
+	if !slices.Contains(models.DuplicatePolicies, policy) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":    "Unknown duplicate policy " + policy,
+			"policies": models.DuplicatePolicies,
+		})
+		return policy, errors.New("unknown duplicate policy")
+	}
+	return policy, nil
+}
+
+func respondWithBatchError(c *gin.Context, err error) {
+	log.Print(err)
+	var duplicateErr *database.DuplicateTransactionsError
+	switch {
+	case errors.As(err, &duplicateErr):
+		c.IndentedJSON(http.StatusConflict, gin.H{
+			"error":      "Some rows repeat existing transactions",
+			"duplicates": duplicateErr.Rows,
+		})
+	case errors.Is(err, database.ErrStatementNotFound):
+		c.IndentedJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
+
+// renumberDuplicateRows replaces batch positions with the rows they came from in the source
+func renumberDuplicateRows(rows []models.DuplicateRow, sourceRows []int) {
+	for i := range rows {
+		rows[i].Row = sourceRows[rows[i].Row-1]
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"moneyd/api/database"
+	"moneyd/api/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTransactionPageSize = 100
+	maxTransactionPageSize     = 1000
+)
+
+// ListTransactionsHandler pages through a user's transactions. The transactionFilter parameters
+// narrow the listing; sort (date, amount, description or date_added) and direction (asc or desc)
+// order it, newest first by default; limit sets the page size. Each page carries a next_cursor,
+// passed back as "cursor" with the same filters and sort to fetch the page after it.
+func ListTransactionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		requestedUserId, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		if requestedUserId != userID {
+			c.IndentedJSON(http.StatusForbidden, gin.H{"error": "Access denied: cannot access other users' data"})
+			return
+		}
+
+		filter, err := transactionFilter(c)
+		if err != nil {
+			return
+		}
+
+		sort := models.TransactionSort{Field: strings.ToLower(c.DefaultQuery("sort", models.TransactionSortDate))}
+		if !slices.Contains(models.TransactionSorts, sort.Field) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown sort " + sort.Field,
+				"sorts": models.TransactionSorts,
+			})
+			return
+		}
+		switch strings.ToLower(c.DefaultQuery("direction", "desc")) {
+		case "asc":
+		case "desc":
+			sort.Descending = true
+		default:
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "direction must be asc or desc"})
+			return
+		}
+
+		limit := defaultTransactionPageSize
+		if value := c.Query("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxTransactionPageSize {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxTransactionPageSize)})
+				return
+			}
+		}
+
+		page, err := database.ListTransactionsAuthorized(filter, sort, c.Query("cursor"), limit, userID, db)
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidCursor) {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor for this sort"})
+			} else {
+				c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, page)
+	}
+}
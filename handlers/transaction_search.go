@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"moneyd/api/database"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultTransactionSearchLimit = 50
+	maxTransactionSearchLimit     = 200
+	maxTransactionSearchLength    = 200
+)
+
+// SearchTransactionsHandler searches the user's transaction descriptions and counterparty names
+// for "q", ranked by relevance, with highlighted snippets. The transactionFilter parameters narrow
+// the search, so "amazon refund" with from and to covering March finds last March's Amazon
+// refund; limit caps the number of results.
+func SearchTransactionsHandler(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text := strings.TrimSpace(c.Query("q"))
+		if text == "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+		if utf8.RuneCountInString(text) > maxTransactionSearchLength {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "q must be at most " + strconv.Itoa(maxTransactionSearchLength) + " characters"})
+			return
+		}
+
+		filter, err := transactionFilter(c)
+		if err != nil {
+			return
+		}
+
+		limit := defaultTransactionSearchLimit
+		if value := c.Query("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxTransactionSearchLimit {
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxTransactionSearchLimit)})
+				return
+			}
+		}
+
+		results, err := database.SearchTransactionsAuthorized(text, filter, limit, c.GetInt("user_id"), db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusOK, results)
+	}
+}
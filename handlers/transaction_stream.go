@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"moneyd/api/database"
+	"moneyd/api/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ndjsonChunkSize lines are decoded and inserted together
+	ndjsonChunkSize   = 1000
+	maxNdjsonLineSize = 1 << 20
+)
+
+// StreamTransactionsHandler imports newline-delimited JSON, one transaction object per line, for
+// backfills too large to bind as one array. The body is decoded and inserted ndjsonChunkSize lines
+// at a time, all in one database transaction. Lines that are not valid JSON, name a statement the
+// user does not own or are missing fields are reported as failed and left out; duplicates are
+// handled by the "duplicates" query parameter as in POST /transactions/batch.
+func StreamTransactionsHandler(db *sql.DB, defaultPolicy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+
+		policy, err := duplicatePolicy(c, defaultPolicy)
+		if err != nil {
+			return
+		}
+
+		statements, err := database.GetStatementsByUserId(userID, db)
+		if err != nil {
+			log.Print(err)
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		ownedStatements := make(map[int]bool, len(statements))
+		for _, statement := range statements {
+			ownedStatements[statement.StatementId] = true
+		}
+
+		knownTypes, err := transactionTypeCodes(db)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		summary := models.TransactionStreamSummary{
+			SkippedLines: []models.DuplicateRow{},
+			FlaggedLines: []models.DuplicateRow{},
+			FailedLines:  []models.ImportRowError{},
+		}
+		fail := func(line int, reason string) {
+			summary.Failed++
+			summary.FailedLines = append(summary.FailedLines, models.ImportRowError{Row: line, Reason: reason})
+		}
+
+		scanner := bufio.NewScanner(c.Request.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxNdjsonLineSize)
+
+		// chunkLines maps positions in the current chunk back to line numbers
+		var chunkLines []int
+		var readErr error
+		next := func() ([]models.Transaction, error) {
+			var txns []models.Transaction
+			chunkLines = chunkLines[:0]
+			for len(txns) < ndjsonChunkSize && scanner.Scan() {
+				summary.Lines++
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) == 0 {
+					continue
+				}
+
+				var txn models.Transaction
+				if err := json.Unmarshal(line, &txn); err != nil {
+					fail(summary.Lines, "invalid JSON: "+err.Error())
+					continue
+				}
+				if !ownedStatements[txn.StatementId] {
+					fail(summary.Lines, fmt.Sprintf("statement %d not found or access denied", txn.StatementId))
+					continue
+				}
+				if reason := importRowProblem(txn, knownTypes); reason != "" {
+					fail(summary.Lines, reason)
+					continue
+				}
+
+				txns = append(txns, txn)
+				chunkLines = append(chunkLines, summary.Lines)
+			}
+			if len(txns) > 0 {
+				return txns, nil
+			}
+			if readErr = scanner.Err(); readErr != nil {
+				return nil, readErr
+			}
+			return nil, io.EOF
+		}
+
+		report := func(result models.TransactionBatchResult) {
+			renumberDuplicateRows(result.Skipped, chunkLines)
+			renumberDuplicateRows(result.Flagged, chunkLines)
+			summary.Inserted += len(result.Transactions)
+			summary.Skipped += len(result.Skipped)
+			summary.Flagged += len(result.Flagged)
+			summary.SkippedLines = append(summary.SkippedLines, result.Skipped...)
+			summary.FlaggedLines = append(summary.FlaggedLines, result.Flagged...)
+		}
+
+		err = database.CreateTransactionsStreamAuthorized(next, report, policy, userID, db)
+		if err != nil {
+			var duplicateErr *database.DuplicateTransactionsError
+			switch {
+			case errors.Is(readErr, bufio.ErrTooLong):
+				c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": fmt.Sprintf("Line %d is longer than %d bytes; nothing was imported", summary.Lines+1, maxNdjsonLineSize),
+				})
+			case readErr != nil:
+				log.Print(readErr)
+				c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Could not read request body; nothing was imported"})
+			case errors.As(err, &duplicateErr):
+				renumberDuplicateRows(duplicateErr.Rows, chunkLines)
+				respondWithBatchError(c, err)
+			default:
+				respondWithBatchError(c, err)
+			}
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, summary)
+	}
+}
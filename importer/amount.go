@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseAmount converts a bank-formatted amount such as "$1,234.56", "(12.00)", "12.00-" or,
+// with decimalSeparator ",", "1.234,56" into cents without going through floating point
+func ParseAmount(value string, decimalSeparator string) (int64, error) {
+	if decimalSeparator == "" {
+		decimalSeparator = "."
+	}
+
+	s := strings.TrimSpace(trimCurrencyCode(strings.TrimSpace(value)))
+	if s == "" {
+		return 0, fmt.Errorf("amount is empty")
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case string(r) == decimalSeparator:
+			digits.WriteRune('.')
+		case r == '-':
+			negative = !negative
+		case r == '.' || r == ',' || r == ' ' || r == '\'' || r == '+' || r == '\u00a0':
+			// thousands separators and explicit positive signs
+		case strings.ContainsRune("$€£¥", r):
+			// currency symbols
+		default:
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	whole, fraction, _ := strings.Cut(digits.String(), ".")
+	if whole == "" && fraction == "" || strings.Contains(fraction, ".") {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, fmt.Errorf("amount %q has more than two decimal places", value)
+		}
+		fraction = fraction[:2]
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	cents, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		cents = -cents
+	}
+	return cents, nil
+}
+
+// trimCurrencyCode removes an ISO 4217 code such as "EUR" from either end of an amount, as in
+// "EUR 12.00" or "12.00USD". Letters anywhere else are left for ParseAmount to reject.
+func trimCurrencyCode(s string) string {
+	isCode := func(code string) bool {
+		for _, r := range code {
+			if r < 'A' || r > 'Z' {
+				return false
+			}
+		}
+		return true
+	}
+	isLetter := func(b byte) bool {
+		return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z'
+	}
+
+	if len(s) >= 3 && isCode(s[:3]) && (len(s) == 3 || !isLetter(s[3])) {
+		return s[3:]
+	}
+	if n := len(s); n >= 3 && isCode(s[n-3:]) && (n == 3 || !isLetter(s[n-4])) {
+		return s[:n-3]
+	}
+	return s
+}
+
+// guessDecimalSeparator works out the decimal separator of an amount in a format that does not
+// declare one: a comma is decimal when it comes after any dot and is not followed by exactly
+// three digits, as in "12,50" or "1.234,56"
+func guessDecimalSeparator(value string) string {
+	comma := strings.LastIndexByte(value, ',')
+	if comma < 0 || comma < strings.LastIndexByte(value, '.') {
+		return "."
+	}
+	digits := 0
+	for _, r := range value[comma+1:] {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	if digits == 3 && !strings.Contains(value, ".") {
+		return "."
+	}
+	return ","
+}
+
+var dateFormatTokens = strings.NewReplacer(
+	"YYYY", "2006",
+	"YY", "06",
+	"MMM", "Jan",
+	"MM", "01",
+	"DD", "02",
+)
+
+// ParseDate reads a date using either a Go reference layout ("01/02/2006") or the
+// YYYY/MM/DD style most bank documentation uses ("MM/DD/YYYY", "DD.MM.YY", "DD MMM YYYY")
+func ParseDate(value string, format string) (time.Time, error) {
+	layout := format
+	if strings.ContainsAny(format, "YD") {
+		layout = dateFormatTokens.Replace(format)
+	}
+
+	date, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		return date, fmt.Errorf("date %q does not match format %q", value, format)
+	}
+	return date, nil
+}
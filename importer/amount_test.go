@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value            string
+		decimalSeparator string
+		want             int64
+		wantErr          bool
+	}{
+		{value: "12.34", want: 1234},
+		{value: "12", want: 1200},
+		{value: "12.5", want: 1250},
+		{value: ".5", want: 50},
+		{value: "-12.34", want: -1234},
+		{value: "12.34-", want: -1234},
+		{value: "(12.00)", want: -1200},
+		{value: "+7.00", want: 700},
+		{value: "$1,234.56", want: 123456},
+		{value: "EUR 1 234.56", want: 123456},
+		{value: "-12.00 USD", want: -1200},
+		{value: "USD-5.00", want: -500},
+		{value: "(3.00)GBP", want: -300},
+		{value: "€5,00 EUR", decimalSeparator: ",", want: 500},
+		{value: "1.234,56", decimalSeparator: ",", want: 123456},
+		{value: "-0,99", decimalSeparator: ",", want: -99},
+		{value: "1'000.00", want: 100000},
+		{value: "12.340", want: 1234},
+		{value: "  3.10  ", want: 310},
+		{value: "12.345", wantErr: true},
+		{value: "1,2,3", decimalSeparator: ",", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "   ", wantErr: true},
+		{value: "-", wantErr: true},
+		{value: "12a", wantErr: true},
+		{value: "1E5", wantErr: true},
+		{value: "12 AB", wantErr: true},
+		{value: "EURO 5.00", wantErr: true},
+		{value: "5.00 eur", wantErr: true},
+		{value: "1O0.00", wantErr: true},
+		{value: "USD", wantErr: true},
+		{value: "99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.value, tt.decimalSeparator)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseAmount(%q, %q) = %d, want an error", tt.value, tt.decimalSeparator, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %q) returned error: %v", tt.value, tt.decimalSeparator, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q, %q) = %d, want %d", tt.value, tt.decimalSeparator, got, tt.want)
+		}
+	}
+}
+
+func TestGuessDecimalSeparator(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"12.50", "."},
+		{"12,50", ","},
+		{"1.234,56", ","},
+		{"1,234.56", "."},
+		{"1,234", "."},
+		{"-5,5", ","},
+		{"100", "."},
+	}
+
+	for _, tt := range tests {
+		if got := guessDecimalSeparator(tt.value); got != tt.want {
+			t.Errorf("guessDecimalSeparator(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		format  string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2026-01-31", format: "YYYY-MM-DD", want: date(2026, 1, 31)},
+		{value: "01/31/2026", format: "MM/DD/YYYY", want: date(2026, 1, 31)},
+		{value: "31.01.26", format: "DD.MM.YY", want: date(2026, 1, 31)},
+		{value: "31 Jan 2026", format: "DD MMM YYYY", want: date(2026, 1, 31)},
+		{value: " 01/31/2026 ", format: "01/02/2006", want: date(2026, 1, 31)},
+		{value: "2026-02-30", format: "YYYY-MM-DD", wantErr: true},
+		{value: "31/01/2026", format: "MM/DD/YYYY", wantErr: true},
+		{value: "", format: "YYYY-MM-DD", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value, tt.format)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDate(%q, %q) = %v, want an error", tt.value, tt.format, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDate(%q, %q) returned error: %v", tt.value, tt.format, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q, %q) = %v, want %v", tt.value, tt.format, got, tt.want)
+		}
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
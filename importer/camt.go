@@ -0,0 +1,260 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"moneyd/api/models"
+	"strings"
+	"time"
+)
+
+// The subset of an ISO 20022 camt.053 (BankToCustomerStatement) document the importer reads.
+// Element names are matched without namespaces so every camt.053.001.xx version parses.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	From        string      `xml:"FrToDt>FrDtTm"`
+	To          string      `xml:"FrToDt>ToDtTm"`
+	Institution string      `xml:"Acct>Svcr>FinInstnId>Nm"`
+	Entries     []camtEntry `xml:"Ntry"`
+}
+
+type camtEntry struct {
+	Amount           string          `xml:"Amt"`
+	CreditDebit      string          `xml:"CdtDbtInd"`
+	Reversal         bool            `xml:"RvslInd"`
+	Status           camtStatus      `xml:"Sts"`
+	BookingDate      camtDate        `xml:"BookgDt"`
+	ValueDate        camtDate        `xml:"ValDt"`
+	AcctSvcrRef      string          `xml:"AcctSvcrRef"`
+	AdditionalInfo   string          `xml:"AddtlNtryInf"`
+	TransactionInfos []camtTxDetails `xml:"NtryDtls>TxDtls"`
+}
+
+// camtStatus is a plain code before camt.053.001.08 and wrapped in Cd from then on
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtTxDetails struct {
+	Amount          string    `xml:"Amt"`
+	InstructedAmt   string    `xml:"AmtDtls>TxAmt>Amt"`
+	AcctSvcrRef     string    `xml:"Refs>AcctSvcrRef"`
+	TxId            string    `xml:"Refs>TxId"`
+	EndToEndId      string    `xml:"Refs>EndToEndId"`
+	Debtor          camtParty `xml:"RltdPties>Dbtr"`
+	DebtorAccount   camtAcct  `xml:"RltdPties>DbtrAcct"`
+	Creditor        camtParty `xml:"RltdPties>Cdtr"`
+	CreditorAccount camtAcct  `xml:"RltdPties>CdtrAcct"`
+	Unstructured    []string  `xml:"RmtInf>Ustrd"`
+	AdditionalInfo  string    `xml:"AddtlTxInf"`
+}
+
+// camtParty covers both the flat (camt.053.001.02) and Pty-wrapped (.08 onwards) party names
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+type camtAcct struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+// ParseCAMT053 reads an ISO 20022 camt.053 account statement. Only booked entries are imported;
+// the booking date becomes TransactionDate and the value date ValueDate. Batched entries whose
+// details each carry an amount are split into one transaction per detail. CdtDbtInd alone gives
+// an entry's direction, reversals included: a refunded debit arrives as a credit with RvslInd set,
+// which is noted at the start of its description.
+func ParseCAMT053(r io.Reader) (Result, error) {
+	var result Result
+
+	var doc camtDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return result, fmt.Errorf("file is not a camt.053 document: %w", err)
+	}
+
+	switch len(doc.Statements) {
+	case 0:
+		return result, errors.New("camt.053 file contains no statement")
+	case 1:
+	default:
+		return result, fmt.Errorf("camt.053 file contains %d account statements; upload one account at a time", len(doc.Statements))
+	}
+	statement := doc.Statements[0]
+
+	result.InstitutionName = strings.TrimSpace(statement.Institution)
+	if statement.From != "" && statement.To != "" {
+		var err error
+		if result.Statement.PeriodStart, err = parseISODate(statement.From); err != nil {
+			return result, fmt.Errorf("FrDtTm: %w", err)
+		}
+		if result.Statement.PeriodEnd, err = parseISODate(statement.To); err != nil {
+			return result, fmt.Errorf("ToDtTm: %w", err)
+		}
+	}
+
+	for i, entry := range statement.Entries {
+		status := strings.TrimSpace(entry.Status.Code)
+		if status == "" {
+			status = strings.TrimSpace(entry.Status.Text)
+		}
+		if status != "" && status != "BOOK" {
+			continue
+		}
+
+		txns, reason := camtTransactions(entry)
+		if reason != "" {
+			result.Errors = append(result.Errors, RowError{Row: i + 1, Reason: reason})
+			continue
+		}
+		for _, txn := range txns {
+			result.add(i+1, txn)
+		}
+	}
+
+	return result, nil
+}
+
+func camtTransactions(entry camtEntry) ([]models.Transaction, string) {
+	bookingDate, err := entry.BookingDate.parse()
+	if err != nil {
+		return nil, "BookgDt: " + err.Error()
+	}
+	var valueDate *time.Time
+	if entry.ValueDate.Date != "" || entry.ValueDate.DateTime != "" {
+		date, err := entry.ValueDate.parse()
+		if err != nil {
+			return nil, "ValDt: " + err.Error()
+		}
+		valueDate = &date
+	}
+
+	var sign int64
+	switch entry.CreditDebit {
+	case "CRDT":
+		sign = 1
+	case "DBIT":
+		sign = -1
+	default:
+		return nil, fmt.Sprintf("unknown CdtDbtInd %q", entry.CreditDebit)
+	}
+
+	details := entry.TransactionInfos
+	split := len(details) > 1
+	for _, detail := range details {
+		if detail.amount() == "" {
+			split = false
+		}
+	}
+	if !split {
+		var detail camtTxDetails
+		if len(details) > 0 {
+			detail = details[0]
+		}
+		detail.Amount = entry.Amount
+		if detail.AcctSvcrRef == "" {
+			detail.AcctSvcrRef = entry.AcctSvcrRef
+		}
+		details = []camtTxDetails{detail}
+	}
+
+	var txns []models.Transaction
+	for _, detail := range details {
+		amount, err := ParseAmount(detail.amount(), ".")
+		if err != nil {
+			return nil, "Amt: " + err.Error()
+		}
+		amount = sign * abs(amount)
+
+		counterparty, account := detail.Debtor, detail.DebtorAccount
+		if sign < 0 {
+			counterparty, account = detail.Creditor, detail.CreditorAccount
+		}
+		name := strings.TrimSpace(counterparty.Name)
+		if name == "" {
+			name = strings.TrimSpace(counterparty.PartyName)
+		}
+		accountId := account.IBAN
+		if accountId == "" {
+			accountId = account.Other
+		}
+
+		description := strings.TrimSpace(strings.Join(detail.Unstructured, " "))
+		if description == "" {
+			description = strings.TrimSpace(detail.AdditionalInfo)
+		}
+		if description == "" {
+			description = strings.TrimSpace(entry.AdditionalInfo)
+		}
+		if name != "" && !strings.Contains(description, name) {
+			description = strings.TrimSpace(name + " " + description)
+		}
+		if description == "" {
+			return nil, "entry has no remittance information or counterparty"
+		}
+		if entry.Reversal {
+			description = "Reversal: " + description
+		}
+
+		txns = append(txns, models.Transaction{
+			TransactionDate:     bookingDate,
+			ValueDate:           valueDate,
+			Amount:              amount,
+			Description:         description,
+			ExternalId:          detail.reference(),
+			CounterpartyName:    name,
+			CounterpartyAccount: strings.TrimSpace(accountId),
+		})
+	}
+
+	return txns, ""
+}
+
+func (d camtTxDetails) amount() string {
+	if d.Amount != "" {
+		return d.Amount
+	}
+	return d.InstructedAmt
+}
+
+// reference picks the most specific bank-assigned identifier for a transaction
+func (d camtTxDetails) reference() string {
+	for _, ref := range []string{d.AcctSvcrRef, d.TxId, d.EndToEndId} {
+		ref = strings.TrimSpace(ref)
+		if ref != "" && ref != "NOTPROVIDED" {
+			return ref
+		}
+	}
+	return ""
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if d.Date != "" {
+		return parseISODate(d.Date)
+	}
+	return parseISODate(d.DateTime)
+}
+
+// parseISODate reads the calendar date from an ISO 8601 date or date-time
+func parseISODate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 10 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("2006-01-02", value[:10])
+	if err != nil {
+		return date, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
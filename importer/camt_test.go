@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// camtStatementXML wraps entries in a camt.053.001.02 document
+func camtStatementXML(entries string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+<FrToDt><FrDtTm>2026-01-01T00:00:00</FrDtTm><ToDtTm>2026-01-31T23:59:59</ToDtTm></FrToDt>
+<Acct><Svcr><FinInstnId><Nm> Example Bank </Nm></FinInstnId></Svcr></Acct>
+` + entries + `
+</Stmt></BkToCstmrStmt>
+</Document>`
+}
+
+func TestParseCAMT053(t *testing.T) {
+	type row struct {
+		line         int
+		date         time.Time
+		amount       int64
+		description  string
+		externalId   string
+		counterparty string
+		account      string
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		want       []row
+		wantErrors []int
+		wantFail   bool
+	}{
+		{
+			name: "debit with creditor details",
+			input: camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">12.50</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-05</Dt></BookgDt><ValDt><Dt>2026-01-06</Dt></ValDt>
+<NtryDtls><TxDtls>
+<Refs><EndToEndId>NOTPROVIDED</EndToEndId><TxId>TX1</TxId></Refs>
+<RltdPties><Cdtr><Nm>Bakery</Nm></Cdtr><CdtrAcct><Id><IBAN>DE02100100100006820101</IBAN></Id></CdtrAcct></RltdPties>
+<RmtInf><Ustrd>Bread</Ustrd><Ustrd>and rolls</Ustrd></RmtInf>
+</TxDtls></NtryDtls>
+</Ntry>`),
+			want: []row{{1, date(2026, 1, 5), -1250, "Bakery Bread and rolls", "TX1", "Bakery", "DE02100100100006820101"}},
+		},
+		{
+			name: "reversal of a debit arrives as a positive credit",
+			input: camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">12.50</Amt><CdtDbtInd>CRDT</CdtDbtInd><RvslInd>true</RvslInd><Sts><Cd>BOOK</Cd></Sts>
+<BookgDt><DtTm>2026-01-07T10:00:00+01:00</DtTm></BookgDt>
+<AcctSvcrRef>REF-R1</AcctSvcrRef>
+<NtryDtls><TxDtls>
+<RltdPties><Dbtr><Pty><Nm>Bakery</Nm></Pty></Dbtr></RltdPties>
+<RmtInf><Ustrd>Bread</Ustrd></RmtInf>
+</TxDtls></NtryDtls>
+</Ntry>`),
+			want: []row{{1, date(2026, 1, 7), 1250, "Reversal: Bakery Bread", "REF-R1", "Bakery", ""}},
+		},
+		{
+			name: "reversal of a credit arrives as a negative debit",
+			input: camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">40.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><RvslInd>true</RvslInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-08</Dt></BookgDt>
+<AddtlNtryInf>Returned transfer</AddtlNtryInf>
+</Ntry>`),
+			want: []row{{1, date(2026, 1, 8), -4000, "Reversal: Returned transfer", "", "", ""}},
+		},
+		{
+			name: "batched entry is split per detail",
+			input: camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">30.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-09</Dt></BookgDt>
+<NtryDtls>
+<TxDtls><Refs><AcctSvcrRef>B1</AcctSvcrRef></Refs><Amt Ccy="EUR">10.00</Amt><RltdPties><Dbtr><Nm>Alice</Nm></Dbtr><DbtrAcct><Id><Othr><Id>12345</Id></Othr></Id></DbtrAcct></RltdPties></TxDtls>
+<TxDtls><Refs><AcctSvcrRef>B2</AcctSvcrRef></Refs><AmtDtls><TxAmt><Amt Ccy="EUR">20.00</Amt></TxAmt></AmtDtls><RltdPties><Dbtr><Nm>Bob</Nm></Dbtr></RltdPties></TxDtls>
+</NtryDtls>
+</Ntry>`),
+			want: []row{
+				{1, date(2026, 1, 9), 1000, "Alice", "B1", "Alice", "12345"},
+				{1, date(2026, 1, 9), 2000, "Bob", "B2", "Bob", ""},
+			},
+		},
+		{
+			name: "pending entries are skipped and bad entries reported",
+			input: camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>PDNG</Sts>
+<BookgDt><Dt>2026-01-10</Dt></BookgDt><AddtlNtryInf>Pending</AddtlNtryInf>
+</Ntry>
+<Ntry>
+<Amt Ccy="EUR">1.00</Amt><CdtDbtInd>SIDEWAYS</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-10</Dt></BookgDt><AddtlNtryInf>Unknown direction</AddtlNtryInf>
+</Ntry>
+<Ntry>
+<Amt Ccy="EUR">1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-10</Dt></BookgDt>
+</Ntry>
+<Ntry>
+<Amt Ccy="EUR">2.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+<BookgDt><Dt>2026-01-11</Dt></BookgDt><AddtlNtryInf>Fee</AddtlNtryInf>
+</Ntry>`),
+			want:       []row{{4, date(2026, 1, 11), -200, "Fee", "", "", ""}},
+			wantErrors: []int{2, 3},
+		},
+		{
+			name:     "not XML",
+			input:    "Date,Amount\n",
+			wantFail: true,
+		},
+		{
+			name:     "no statement",
+			input:    `<Document><BkToCstmrStmt></BkToCstmrStmt></Document>`,
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseCAMT053(strings.NewReader(tt.input))
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("%s: ParseCAMT053() succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseCAMT053() returned error: %v", tt.name, err)
+			continue
+		}
+
+		if result.InstitutionName != "Example Bank" {
+			t.Errorf("%s: institution = %q, want %q", tt.name, result.InstitutionName, "Example Bank")
+		}
+		if !result.Statement.PeriodStart.Equal(date(2026, 1, 1)) || !result.Statement.PeriodEnd.Equal(date(2026, 1, 31)) {
+			t.Errorf("%s: period = %v to %v", tt.name, result.Statement.PeriodStart, result.Statement.PeriodEnd)
+		}
+		if len(result.Transactions) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d: %+v", tt.name, len(result.Transactions), len(tt.want), result.Transactions)
+			continue
+		}
+		for i, want := range tt.want {
+			got := result.Transactions[i]
+			if result.Rows[i] != want.line || !got.TransactionDate.Equal(want.date) || got.Amount != want.amount ||
+				got.Description != want.description || got.ExternalId != want.externalId ||
+				got.CounterpartyName != want.counterparty || got.CounterpartyAccount != want.account {
+				t.Errorf("%s: transaction %d = row %d %+v, want %+v", tt.name, i, result.Rows[i], got, want)
+			}
+		}
+		if got := errorRows(result); !slices.Equal(got, tt.wantErrors) {
+			t.Errorf("%s: errors on rows %v, want %v (%+v)", tt.name, got, tt.wantErrors, result.Errors)
+		}
+	}
+}
+
+func TestParseCAMT053ValueDate(t *testing.T) {
+	result, err := ParseCAMT053(strings.NewReader(camtStatementXML(`<Ntry>
+<Amt Ccy="EUR">5.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts>
+<BookgDt><Dt>2026-01-05</Dt></BookgDt><ValDt><DtTm>2026-01-04T08:00:00Z</DtTm></ValDt>
+<AddtlNtryInf>Interest</AddtlNtryInf>
+</Ntry>`)))
+	if err != nil {
+		t.Fatalf("ParseCAMT053() returned error: %v", err)
+	}
+	if len(result.Transactions) != 1 {
+		t.Fatalf("got %d transactions, want 1", len(result.Transactions))
+	}
+	valueDate := result.Transactions[0].ValueDate
+	if valueDate == nil || !valueDate.Equal(date(2026, 1, 4)) {
+		t.Errorf("ValueDate = %v, want 2026-01-04", valueDate)
+	}
+}
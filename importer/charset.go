@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252 maps bytes 0x80-0x9F of Windows-1252 to Unicode. Every other byte has the same
+// value as its code point, as in ISO-8859-1; the five bytes Windows-1252 leaves undefined are
+// passed through the same way.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// decodeText returns a file's text as UTF-8. Text declared as UTF-8 must be valid UTF-8. Text
+// declared as Windows-1252 or ISO-8859-1, the 8-bit character sets banks still export in, is
+// decoded as Windows-1252, which agrees with ISO-8859-1 on every printable character. Anything
+// else is taken as UTF-8 when it is valid and as Windows-1252 otherwise.
+func decodeText(data []byte, charset string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(charset)) {
+	case "UTF-8", "UTF8", "UNICODE":
+		if !utf8.Valid(data) {
+			return "", errors.New("file declares UTF-8 but is not valid UTF-8")
+		}
+		return string(data), nil
+	case "1252", "WINDOWS-1252", "CP1252", "ISO-8859-1", "ISO8859-1", "8859-1", "LATIN1":
+		return decodeWindows1252(data), nil
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	return decodeWindows1252(data), nil
+}
+
+func decodeWindows1252(data []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for _, b := range data {
+		switch {
+		case b < 0x80:
+			sb.WriteByte(b)
+		case b < 0xa0:
+			sb.WriteRune(windows1252[b-0x80])
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,35 @@
+package importer
+
+import "testing"
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		charset string
+		want    string
+		wantErr bool
+	}{
+		{name: "declared UTF-8", data: "Café", charset: "UTF-8", want: "Café"},
+		{name: "invalid declared UTF-8", data: "Caf\xe9", charset: "utf-8", wantErr: true},
+		{name: "declared Windows-1252", data: "Caf\xe9 \x80 \x93quoted\x94", charset: "1252", want: "Café € “quoted”"},
+		{name: "declared Latin-1", data: "M\xfcller", charset: "ISO-8859-1", want: "Müller"},
+		{name: "undefined Windows-1252 byte", data: "a\x81b", charset: "windows-1252", want: "a\u0081b"},
+		{name: "undeclared valid UTF-8", data: "Ærø", want: "Ærø"},
+		{name: "undeclared 8-bit", data: "\xc6r\xf8", charset: "NONE", want: "Ærø"},
+		{name: "ASCII", data: "plain", charset: "USASCII", want: "plain"},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeText([]byte(tt.data), tt.charset)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: decodeText() = %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: decodeText() = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
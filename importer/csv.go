@@ -0,0 +1,246 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"moneyd/api/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateCsvMapping checks that a mapping is complete enough to parse a file with
+func ValidateCsvMapping(mapping models.CsvColumnMapping) error {
+	if mapping.DateColumn == "" || mapping.DateFormat == "" {
+		return errors.New("date_column and date_format are required")
+	}
+	if mapping.AmountColumn == "" && (mapping.DebitColumn == "" || mapping.CreditColumn == "") {
+		return errors.New("either amount_column or both debit_column and credit_column are required")
+	}
+	if len(mapping.DescriptionColumns) == 0 {
+		return errors.New("at least one description column is required")
+	}
+	if utf8.RuneCountInString(mapping.Delimiter) > 1 {
+		return errors.New("delimiter must be a single character")
+	}
+	if mapping.DecimalSeparator != "" && mapping.DecimalSeparator != "." && mapping.DecimalSeparator != "," {
+		return errors.New(`decimal_separator must be "." or ","`)
+	}
+	if mapping.AmountSign != "" && mapping.AmountSign != models.AmountSignAsIs && mapping.AmountSign != models.AmountSignInverted {
+		return fmt.Errorf("amount_sign must be %q or %q", models.AmountSignAsIs, models.AmountSignInverted)
+	}
+	if mapping.SkipRows < 0 {
+		return errors.New("skip_rows cannot be negative")
+	}
+	if mapping.DebitTransactionTypeCode == 0 || mapping.CreditTransactionTypeCode == 0 {
+		return errors.New("debit_transaction_type_code and credit_transaction_type_code are required")
+	}
+	return nil
+}
+
+type csvColumns struct {
+	date        int
+	amount      int
+	debit       int
+	credit      int
+	description []int
+}
+
+// ParseCSV reads a bank CSV export using a saved column mapping. A single amount column is
+// read with the bank's sign, flipped when AmountSign is "inverted"; split debit/credit
+// columns always produce negative debits and positive credits.
+func ParseCSV(r io.Reader, mapping models.CsvColumnMapping) (Result, error) {
+	var result Result
+	if err := ValidateCsvMapping(mapping); err != nil {
+		return result, err
+	}
+
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		buffered.Discard(3)
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(mapping.Delimiter)
+	}
+
+	for range mapping.SkipRows {
+		if _, err := reader.Read(); err != nil {
+			return result, fmt.Errorf("file ended before the %d rows to skip", mapping.SkipRows)
+		}
+	}
+
+	var header []string
+	if mapping.HasHeader {
+		record, err := reader.Read()
+		if err != nil {
+			return result, errors.New("file has no header row")
+		}
+		header = record
+	}
+
+	columns, err := resolveCsvColumns(mapping, header)
+	if err != nil {
+		return result, err
+	}
+
+	opts := Options{
+		DebitTransactionTypeCode:  mapping.DebitTransactionTypeCode,
+		CreditTransactionTypeCode: mapping.CreditTransactionTypeCode,
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Errors = append(result.Errors, RowError{Row: parseErr.Line, Reason: parseErr.Err.Error()})
+				continue
+			}
+			return result, err
+		}
+		// Field positions only exist for records that parsed
+		line, _ := reader.FieldPos(0)
+		if isBlankRecord(record) {
+			continue
+		}
+
+		txn, reason := csvTransaction(record, columns, mapping, opts)
+		if reason != "" {
+			result.Errors = append(result.Errors, RowError{Row: line, Reason: reason})
+			continue
+		}
+		result.add(line, txn)
+	}
+
+	return result, nil
+}
+
+func csvTransaction(record []string, columns csvColumns, mapping models.CsvColumnMapping, opts Options) (models.Transaction, string) {
+	var txn models.Transaction
+
+	field := func(index int) string {
+		if index < 0 || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	date, err := ParseDate(field(columns.date), mapping.DateFormat)
+	if err != nil {
+		return txn, err.Error()
+	}
+
+	var amount int64
+	if columns.amount >= 0 {
+		amount, err = ParseAmount(field(columns.amount), mapping.DecimalSeparator)
+		if err != nil {
+			return txn, err.Error()
+		}
+		if mapping.AmountSign == models.AmountSignInverted {
+			amount = -amount
+		}
+	} else {
+		debit, credit := field(columns.debit), field(columns.credit)
+		switch {
+		case debit != "" && credit != "":
+			return txn, "row has both a debit and a credit amount"
+		case debit != "":
+			amount, err = ParseAmount(debit, mapping.DecimalSeparator)
+			amount = -abs(amount)
+		case credit != "":
+			amount, err = ParseAmount(credit, mapping.DecimalSeparator)
+			amount = abs(amount)
+		default:
+			return txn, "row has neither a debit nor a credit amount"
+		}
+		if err != nil {
+			return txn, err.Error()
+		}
+	}
+
+	var parts []string
+	for _, index := range columns.description {
+		if value := field(index); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	if len(parts) == 0 {
+		return txn, "description is empty"
+	}
+
+	txn.TransactionDate = date
+	txn.Amount = amount
+	txn.Description = strings.Join(parts, " ")
+	txn.TransactionTypeLookupCode = opts.typeCode(amount)
+	return txn, ""
+}
+
+func resolveCsvColumns(mapping models.CsvColumnMapping, header []string) (csvColumns, error) {
+	columns := csvColumns{amount: -1, debit: -1, credit: -1}
+	var err error
+
+	if columns.date, err = csvColumnIndex(mapping.DateColumn, header); err != nil {
+		return columns, err
+	}
+	if mapping.AmountColumn != "" {
+		if columns.amount, err = csvColumnIndex(mapping.AmountColumn, header); err != nil {
+			return columns, err
+		}
+	} else {
+		if columns.debit, err = csvColumnIndex(mapping.DebitColumn, header); err != nil {
+			return columns, err
+		}
+		if columns.credit, err = csvColumnIndex(mapping.CreditColumn, header); err != nil {
+			return columns, err
+		}
+	}
+	for _, name := range mapping.DescriptionColumns {
+		index, err := csvColumnIndex(name, header)
+		if err != nil {
+			return columns, err
+		}
+		columns.description = append(columns.description, index)
+	}
+
+	return columns, nil
+}
+
+// csvColumnIndex finds a column by header name, ignoring case, or by zero-based index
+func csvColumnIndex(ref string, header []string) (int, error) {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(ref)) {
+			return i, nil
+		}
+	}
+	if index, err := strconv.Atoi(ref); err == nil && index >= 0 {
+		return index, nil
+	}
+	return -1, fmt.Errorf("column %q not found in file", ref)
+}
+
+func isBlankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
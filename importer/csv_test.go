@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"moneyd/api/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testDebitType  = 2
+	testCreditType = 1
+)
+
+func csvMapping(edit func(*models.CsvColumnMapping)) models.CsvColumnMapping {
+	mapping := models.CsvColumnMapping{
+		HasHeader:                 true,
+		DateColumn:                "Date",
+		DateFormat:                "YYYY-MM-DD",
+		AmountColumn:              "Amount",
+		DescriptionColumns:        []string{"Description"},
+		DebitTransactionTypeCode:  testDebitType,
+		CreditTransactionTypeCode: testCreditType,
+	}
+	if edit != nil {
+		edit(&mapping)
+	}
+	return mapping
+}
+
+func TestValidateCsvMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping models.CsvColumnMapping
+		wantErr bool
+	}{
+		{name: "complete", mapping: csvMapping(nil)},
+		{name: "split amount columns", mapping: csvMapping(func(m *models.CsvColumnMapping) {
+			m.AmountColumn, m.DebitColumn, m.CreditColumn = "", "Out", "In"
+		})},
+		{name: "no date format", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.DateFormat = "" }), wantErr: true},
+		{name: "debit without credit", mapping: csvMapping(func(m *models.CsvColumnMapping) {
+			m.AmountColumn, m.DebitColumn = "", "Out"
+		}), wantErr: true},
+		{name: "no description", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.DescriptionColumns = nil }), wantErr: true},
+		{name: "long delimiter", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.Delimiter = ";;" }), wantErr: true},
+		{name: "bad decimal separator", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.DecimalSeparator = "'" }), wantErr: true},
+		{name: "bad amount sign", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.AmountSign = "flipped" }), wantErr: true},
+		{name: "negative skip rows", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.SkipRows = -1 }), wantErr: true},
+		{name: "no transaction types", mapping: csvMapping(func(m *models.CsvColumnMapping) { m.CreditTransactionTypeCode = 0 }), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateCsvMapping(tt.mapping)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateCsvMapping() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	type row struct {
+		line        int
+		date        time.Time
+		amount      int64
+		description string
+		typeCode    int
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		mapping    models.CsvColumnMapping
+		want       []row
+		wantErrors []int
+		wantFail   bool
+	}{
+		{
+			name:    "single amount column",
+			input:   "Date,Description,Amount\n2026-01-02,Coffee,-3.50\n2026-01-03,Salary,\"1,000.00\"\n",
+			mapping: csvMapping(nil),
+			want: []row{
+				{2, date(2026, 1, 2), -350, "Coffee", testDebitType},
+				{3, date(2026, 1, 3), 100000, "Salary", testCreditType},
+			},
+		},
+		{
+			name:  "inverted sign",
+			input: "Date,Description,Amount\n2026-01-02,Card purchase,12.00\n",
+			mapping: csvMapping(func(m *models.CsvColumnMapping) {
+				m.AmountSign = models.AmountSignInverted
+			}),
+			want: []row{{2, date(2026, 1, 2), -1200, "Card purchase", testDebitType}},
+		},
+		{
+			name:  "split debit and credit columns",
+			input: "Date,Description,Out,In\n2026-01-02,Rent,500.00,\n2026-01-03,Refund,,-20.00\n2026-01-04,Both,1.00,1.00\n2026-01-05,Neither,,\n",
+			mapping: csvMapping(func(m *models.CsvColumnMapping) {
+				m.AmountColumn, m.DebitColumn, m.CreditColumn = "", "out", "IN"
+			}),
+			want: []row{
+				{2, date(2026, 1, 2), -50000, "Rent", testDebitType},
+				{3, date(2026, 1, 3), 2000, "Refund", testCreditType},
+			},
+			wantErrors: []int{4, 5},
+		},
+		{
+			name:  "semicolons, decimal commas, skipped rows and no header",
+			input: "\ufeffAccount 1234\n\n31.01.2026;Bakery;;-1,20\n",
+			mapping: csvMapping(func(m *models.CsvColumnMapping) {
+				m.HasHeader = false
+				m.Delimiter = ";"
+				m.SkipRows = 1
+				m.DateColumn = "0"
+				m.DateFormat = "DD.MM.YYYY"
+				m.AmountColumn = "3"
+				m.DecimalSeparator = ","
+				m.DescriptionColumns = []string{"1", "2"}
+			}),
+			want: []row{{3, date(2026, 1, 31), -120, "Bakery", testDebitType}},
+		},
+		{
+			name:  "description columns are joined",
+			input: "Date,Payee,Memo,Amount\n2026-01-02,ACME, invoice 7 ,-1\n",
+			mapping: csvMapping(func(m *models.CsvColumnMapping) {
+				m.DescriptionColumns = []string{"Payee", "Memo"}
+			}),
+			want: []row{{2, date(2026, 1, 2), -100, "ACME invoice 7", testDebitType}},
+		},
+		{
+			name:       "bad rows are reported and skipped",
+			input:      "Date,Description,Amount\n01/02/2026,Wrong date,1.00\n2026-01-02,,1.00\n2026-01-03,Bad amount,abc\n2026-01-04,Good,2.00\n",
+			mapping:    csvMapping(nil),
+			want:       []row{{5, date(2026, 1, 4), 200, "Good", testCreditType}},
+			wantErrors: []int{2, 3, 4},
+		},
+		{
+			name:    "stray quotes are kept as text",
+			input:   "Date,Description,Amount\n2026-01-02,Joe\"s diner,-8.00\n2026-01-03,\"Quoted \"twice\" here\",-1.00\n2026-01-04,\"Unclosed,-2.00\n",
+			mapping: csvMapping(nil),
+			want: []row{
+				{2, date(2026, 1, 2), -800, "Joe\"s diner", testDebitType},
+				{3, date(2026, 1, 3), -100, "Quoted \"twice\" here", testDebitType},
+			},
+			wantErrors: []int{4},
+		},
+		{
+			name:     "missing column",
+			input:    "Date,Text,Amount\n2026-01-02,Coffee,1.00\n",
+			mapping:  csvMapping(nil),
+			wantFail: true,
+		},
+		{
+			name:     "empty file with header expected",
+			input:    "",
+			mapping:  csvMapping(nil),
+			wantFail: true,
+		},
+		{
+			name:     "invalid mapping",
+			input:    "Date,Description,Amount\n",
+			mapping:  csvMapping(func(m *models.CsvColumnMapping) { m.DateColumn = "" }),
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseCSV(strings.NewReader(tt.input), tt.mapping)
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("%s: ParseCSV() succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseCSV() returned error: %v", tt.name, err)
+			continue
+		}
+
+		if len(result.Transactions) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d: %+v", tt.name, len(result.Transactions), len(tt.want), result.Transactions)
+			continue
+		}
+		for i, want := range tt.want {
+			got := result.Transactions[i]
+			if result.Rows[i] != want.line || !got.TransactionDate.Equal(want.date) || got.Amount != want.amount ||
+				got.Description != want.description || got.TransactionTypeLookupCode != want.typeCode {
+				t.Errorf("%s: transaction %d = row %d %+v, want %+v", tt.name, i, result.Rows[i], got, want)
+			}
+		}
+
+		if got := errorRows(result); !slices.Equal(got, tt.wantErrors) {
+			t.Errorf("%s: errors on rows %v, want %v (%+v)", tt.name, got, tt.wantErrors, result.Errors)
+		}
+	}
+}
+
+// errorRows lists the rows a parser reported errors for, in order
+func errorRows(result Result) []int {
+	var rows []int
+	for _, rowErr := range result.Errors {
+		rows = append(rows, rowErr.Row)
+	}
+	return rows
+}
@@ -0,0 +1,68 @@
+// Package importer turns bank statement exports into the models.Statement and
+// models.Transaction values the batch endpoints accept. Amounts are signed cents:
+// money leaving the account is negative, money arriving is positive.
+package importer
+
+import (
+	"moneyd/api/models"
+	"time"
+)
+
+// RowError explains why one row of an uploaded file could not become a transaction
+type RowError = models.ImportRowError
+
+// Result is everything a parser could read from a file. Statement only carries the
+// fields the format itself knows about; callers fill in the user and institution.
+// InstitutionName is the bank's own name for itself when the format includes one. Rows holds
+// the source row of each transaction, in the same numbering as RowError.
+type Result struct {
+	Statement       models.Statement
+	InstitutionName string
+	Transactions    []models.Transaction
+	Rows            []int
+	Errors          []RowError
+}
+
+func (r *Result) add(row int, txn models.Transaction) {
+	r.Transactions = append(r.Transactions, txn)
+	r.Rows = append(r.Rows, row)
+}
+
+// ApplyOptions gives every transaction the parser could not classify a transaction type
+// and, for formats without a statement period, spans the period over the transactions
+func (r *Result) ApplyOptions(opts Options) {
+	for i := range r.Transactions {
+		if r.Transactions[i].TransactionTypeLookupCode == 0 {
+			r.Transactions[i].TransactionTypeLookupCode = opts.typeCode(r.Transactions[i].Amount)
+		}
+	}
+
+	if !r.Statement.PeriodStart.IsZero() && !r.Statement.PeriodEnd.IsZero() {
+		return
+	}
+	var start, end time.Time
+	for _, txn := range r.Transactions {
+		if start.IsZero() || txn.TransactionDate.Before(start) {
+			start = txn.TransactionDate
+		}
+		if txn.TransactionDate.After(end) {
+			end = txn.TransactionDate
+		}
+	}
+	r.Statement.PeriodStart, r.Statement.PeriodEnd = start, end
+}
+
+// Options carries the settings a file format cannot express itself
+type Options struct {
+	DebitTransactionTypeCode  int
+	CreditTransactionTypeCode int
+	// DayFirstDates reads ambiguous QIF dates such as 03/04/2026 as 3 April rather than March 4
+	DayFirstDates bool
+}
+
+func (o Options) typeCode(amount int64) int {
+	if amount < 0 {
+		return o.DebitTransactionTypeCode
+	}
+	return o.CreditTransactionTypeCode
+}
@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"moneyd/api/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ofxNode is one element of an OFX document. OFX 1.x is SGML and leaves leaf elements
+// unclosed, so both versions are read into this tree instead of through encoding/xml.
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+func (n *ofxNode) child(name string) *ofxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *ofxNode) childValue(name string) string {
+	if c := n.child(name); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// find returns every descendant with the given name, depth first
+func (n *ofxNode) find(name string) []*ofxNode {
+	var found []*ofxNode
+	for _, c := range n.children {
+		if c.name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.find(name)...)
+	}
+	return found
+}
+
+// ParseOFX reads an OFX 1.x (SGML) or 2.x (XML) bank or credit card statement, including
+// Quicken's QFX variant. Each STMTTRN's FITID is kept as the transaction's ExternalId. Text in the
+// Windows-1252 or ISO-8859-1 character sets is converted to UTF-8.
+func ParseOFX(r io.Reader) (Result, error) {
+	var result Result
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return result, err
+	}
+	start := bytes.Index(bytes.ToUpper(data), []byte("<OFX>"))
+	if start < 0 {
+		return result, errors.New("file is not an OFX document")
+	}
+
+	doc, err := decodeText(data[start:], ofxCharset(string(data[:start])))
+	if err != nil {
+		return result, err
+	}
+	root, err := parseOFXTree(doc)
+	if err != nil {
+		return result, err
+	}
+
+	statements := append(root.find("STMTRS"), root.find("CCSTMTRS")...)
+	switch len(statements) {
+	case 0:
+		return result, errors.New("OFX file contains no bank or credit card statement")
+	case 1:
+	default:
+		return result, fmt.Errorf("OFX file contains %d account statements; upload one account at a time", len(statements))
+	}
+	statement := statements[0]
+
+	if fi := root.find("FI"); len(fi) > 0 {
+		result.InstitutionName = fi[0].childValue("ORG")
+	}
+
+	list := statement.child("BANKTRANLIST")
+	if list == nil {
+		return result, errors.New("OFX statement has no BANKTRANLIST")
+	}
+	if result.Statement.PeriodStart, err = parseOFXDate(list.childValue("DTSTART")); err != nil {
+		return result, fmt.Errorf("DTSTART: %w", err)
+	}
+	if result.Statement.PeriodEnd, err = parseOFXDate(list.childValue("DTEND")); err != nil {
+		return result, fmt.Errorf("DTEND: %w", err)
+	}
+
+	entries := 0
+	for _, entry := range list.children {
+		if entry.name != "STMTTRN" {
+			continue
+		}
+		entries++
+		txn, reason := ofxTransaction(entry)
+		if reason != "" {
+			result.Errors = append(result.Errors, RowError{Row: entries, Reason: reason})
+			continue
+		}
+		result.add(entries, txn)
+	}
+
+	return result, nil
+}
+
+func ofxTransaction(entry *ofxNode) (models.Transaction, string) {
+	var txn models.Transaction
+
+	date, err := parseOFXDate(entry.childValue("DTPOSTED"))
+	if err != nil {
+		return txn, "DTPOSTED: " + err.Error()
+	}
+
+	raw := entry.childValue("TRNAMT")
+	amount, err := ParseAmount(raw, guessDecimalSeparator(raw))
+	if err != nil {
+		return txn, "TRNAMT: " + err.Error()
+	}
+
+	name := entry.childValue("NAME")
+	if payee := entry.child("PAYEE"); payee != nil && name == "" {
+		name = payee.childValue("NAME")
+	}
+	description := name
+	if memo := entry.childValue("MEMO"); memo != "" && !strings.EqualFold(memo, name) {
+		description = strings.TrimSpace(name + " " + memo)
+	}
+	if description == "" {
+		return txn, "transaction has no NAME or MEMO"
+	}
+
+	txn.TransactionDate = date
+	txn.Amount = amount
+	txn.Description = description
+	txn.ExternalId = entry.childValue("FITID")
+	return txn, ""
+}
+
+var xmlEncoding = regexp.MustCompile(`(?i)<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// ofxCharset reads the character set declared ahead of the <OFX> element: the encoding of the
+// XML declaration in OFX 2.x, or the ENCODING and CHARSET headers of OFX 1.x, where
+// ENCODING:UNICODE means UTF-8 and ENCODING:USASCII leaves CHARSET (usually 1252) to decide
+func ofxCharset(header string) string {
+	if match := xmlEncoding.FindStringSubmatch(header); match != nil {
+		return match[1]
+	}
+	fields := map[string]string{}
+	for _, line := range strings.Split(header, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[strings.ToUpper(strings.TrimSpace(key))] = strings.ToUpper(strings.TrimSpace(value))
+		}
+	}
+	if encoding := fields["ENCODING"]; encoding == "UNICODE" || encoding == "UTF-8" {
+		return "UTF-8"
+	}
+	return fields["CHARSET"]
+}
+
+// parseOFXTree builds an element tree from OFX markup. An element followed directly by text is
+// a leaf and is closed immediately; closing tags only matter for aggregates, so stray or
+// missing ones are tolerated.
+func parseOFXTree(doc string) (*ofxNode, error) {
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+
+	for {
+		open := strings.IndexByte(doc, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(doc[open:], '>')
+		if end < 0 {
+			return nil, errors.New("OFX file ends inside a tag")
+		}
+		tag := strings.TrimSpace(doc[open+1 : open+end])
+		doc = doc[open+end+1:]
+
+		if tag == "" || strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		if name, closing := strings.CutPrefix(tag, "/"); closing {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+
+		node := &ofxNode{name: strings.ToUpper(strings.Fields(tag)[0])}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, node)
+
+		text := doc
+		if next := strings.IndexByte(doc, '<'); next >= 0 {
+			text = doc[:next]
+		}
+		if value := strings.TrimSpace(text); value != "" {
+			node.value = html.UnescapeString(value)
+		} else if !strings.HasSuffix(tag, "/") {
+			stack = append(stack, node)
+		}
+	}
+
+	return root, nil
+}
+
+// parseOFXDate reads the date part of an OFX datetime such as "20260131120000.000[-5:EST]".
+// The bank's local calendar date is what appears on the statement, so the offset is ignored.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return date, fmt.Errorf("invalid OFX date %q", value)
+	}
+	return date, nil
+}
@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS>
+<FI><ORG>First Bank<FID>1234</FI>
+</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<DTSTART>20260101
+<DTEND>20260131120000.000[-5:EST]
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20260105120000[-5:EST]
+<TRNAMT>-42.10
+<FITID>A1
+<NAME>GROCER &amp; SONS
+<MEMO>Card 1234
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20260110
+<TRNAMT>1500,00
+<FITID>A2
+<NAME>PAYROLL
+<MEMO>payroll
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>2026
+<TRNAMT>-1.00
+<FITID>A3
+<NAME>BROKEN
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+  <CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+    <BANKTRANLIST>
+      <DTSTART>20260201</DTSTART>
+      <DTEND>20260228</DTEND>
+      <STMTTRN>
+        <DTPOSTED>20260203</DTPOSTED>
+        <TRNAMT>-9.99</TRNAMT>
+        <FITID>X9</FITID>
+        <PAYEE><NAME>Streaming Co</NAME></PAYEE>
+      </STMTTRN>
+      <STMTTRN>
+        <DTPOSTED>20260204</DTPOSTED>
+        <TRNAMT>5.00</TRNAMT>
+        <FITID>X10</FITID>
+      </STMTTRN>
+    </BANKTRANLIST>
+  </CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	type row struct {
+		date        time.Time
+		amount      int64
+		description string
+		externalId  string
+	}
+
+	tests := []struct {
+		name            string
+		input           string
+		wantInstitution string
+		wantStart       time.Time
+		wantEnd         time.Time
+		want            []row
+		wantErrors      []int
+		wantFail        bool
+	}{
+		{
+			name:            "OFX 1.x SGML bank statement",
+			input:           ofxSGML,
+			wantInstitution: "First Bank",
+			wantStart:       date(2026, 1, 1),
+			wantEnd:         date(2026, 1, 31),
+			want: []row{
+				{date(2026, 1, 5), -4210, "GROCER & SONS Card 1234", "A1"},
+				{date(2026, 1, 10), 150000, "PAYROLL", "A2"},
+			},
+			wantErrors: []int{3},
+		},
+		{
+			name:      "OFX 2.x XML credit card statement",
+			input:     ofxXML,
+			wantStart: date(2026, 2, 1),
+			wantEnd:   date(2026, 2, 28),
+			want: []row{
+				{date(2026, 2, 3), -999, "Streaming Co", "X9"},
+			},
+			wantErrors: []int{2},
+		},
+		{
+			name:      "OFX 1.x in Windows-1252",
+			input:     "OFXHEADER:100\nENCODING:USASCII\nCHARSET:1252\n\n<OFX><STMTRS><BANKTRANLIST><DTSTART>20260101<DTEND>20260131<STMTTRN><DTPOSTED>20260103<TRNAMT>-4.50<FITID>W1<NAME>Caf\xe9 M\xfcller \x80</STMTTRN></BANKTRANLIST></STMTRS></OFX>",
+			wantStart: date(2026, 1, 1),
+			wantEnd:   date(2026, 1, 31),
+			want:      []row{{date(2026, 1, 3), -450, "Café Müller €", "W1"}},
+		},
+		{
+			name:      "OFX 2.x declaring ISO-8859-1",
+			input:     "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<OFX><STMTRS><BANKTRANLIST><DTSTART>20260101</DTSTART><DTEND>20260131</DTEND><STMTTRN><DTPOSTED>20260104</DTPOSTED><TRNAMT>1.00</TRNAMT><FITID>L1</FITID><NAME>Se\xf1or</NAME></STMTTRN></BANKTRANLIST></STMTRS></OFX>",
+			wantStart: date(2026, 1, 1),
+			wantEnd:   date(2026, 1, 31),
+			want:      []row{{date(2026, 1, 4), 100, "Señor", "L1"}},
+		},
+		{
+			name:     "declared UTF-8 that is not",
+			input:    "OFXHEADER:100\nENCODING:UNICODE\n\n<OFX><STMTRS><BANKTRANLIST><STMTTRN><NAME>Caf\xe9</STMTTRN></BANKTRANLIST></STMTRS></OFX>",
+			wantFail: true,
+		},
+		{
+			name:     "not OFX",
+			input:    "Date,Amount\n",
+			wantFail: true,
+		},
+		{
+			name:     "no statement",
+			input:    "<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>",
+			wantFail: true,
+		},
+		{
+			name:     "two statements",
+			input:    "<OFX><STMTRS><BANKTRANLIST></BANKTRANLIST></STMTRS><STMTRS><BANKTRANLIST></BANKTRANLIST></STMTRS></OFX>",
+			wantFail: true,
+		},
+		{
+			name:     "unterminated tag",
+			input:    "<OFX><STMTRS",
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseOFX(strings.NewReader(tt.input))
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("%s: ParseOFX() succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseOFX() returned error: %v", tt.name, err)
+			continue
+		}
+
+		if result.InstitutionName != tt.wantInstitution {
+			t.Errorf("%s: institution = %q, want %q", tt.name, result.InstitutionName, tt.wantInstitution)
+		}
+		if !result.Statement.PeriodStart.Equal(tt.wantStart) || !result.Statement.PeriodEnd.Equal(tt.wantEnd) {
+			t.Errorf("%s: period = %v to %v, want %v to %v", tt.name, result.Statement.PeriodStart, result.Statement.PeriodEnd, tt.wantStart, tt.wantEnd)
+		}
+		if len(result.Transactions) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d: %+v", tt.name, len(result.Transactions), len(tt.want), result.Transactions)
+			continue
+		}
+		for i, want := range tt.want {
+			got := result.Transactions[i]
+			if !got.TransactionDate.Equal(want.date) || got.Amount != want.amount || got.Description != want.description || got.ExternalId != want.externalId {
+				t.Errorf("%s: transaction %d = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+		if got := errorRows(result); !slices.Equal(got, tt.wantErrors) {
+			t.Errorf("%s: errors on rows %v, want %v (%+v)", tt.name, got, tt.wantErrors, result.Errors)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"moneyd/api/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qifAccountTypes are the !Type sections that hold cash-account transactions. Investment,
+// category, class and memorized-transaction sections are skipped.
+var qifAccountTypes = map[string]bool{
+	"bank":  true,
+	"cash":  true,
+	"ccard": true,
+	"oth a": true,
+	"oth l": true,
+}
+
+// ParseQIF reads the cash-account sections of a Quicken Interchange Format file. QIF has no
+// statement period or transaction identifiers, so the period is left for ApplyOptions to span.
+// Split lines are ignored; the T line already carries the transaction total. QIF declares no
+// character set, so a file that is not valid UTF-8 is read as Windows-1252.
+func ParseQIF(r io.Reader, opts Options) (Result, error) {
+	var result Result
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return result, err
+	}
+	text, err := decodeText(data, "")
+	if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	inAccount := false
+	sawType := false
+	record := map[byte]string{}
+	recordLine := 0
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			header := strings.ToLower(strings.TrimSpace(text))
+			if kind, ok := strings.CutPrefix(header, "!type:"); ok {
+				inAccount = qifAccountTypes[strings.TrimSpace(kind)]
+				sawType = true
+			} else if header == "!account" {
+				inAccount = false
+			}
+			record = map[byte]string{}
+			continue
+		}
+
+		if text[0] == '^' {
+			if inAccount && len(record) > 0 {
+				txn, reason := qifTransaction(record, opts)
+				if reason != "" {
+					result.Errors = append(result.Errors, RowError{Row: recordLine, Reason: reason})
+				} else {
+					result.add(recordLine, txn)
+				}
+			}
+			record = map[byte]string{}
+			continue
+		}
+
+		if len(record) == 0 {
+			recordLine = line
+		}
+		code, value := text[0], strings.TrimSpace(text[1:])
+		if _, seen := record[code]; !seen {
+			record[code] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	if !sawType {
+		return result, errors.New("file is not a QIF document")
+	}
+
+	return result, nil
+}
+
+func qifTransaction(record map[byte]string, opts Options) (models.Transaction, string) {
+	var txn models.Transaction
+
+	date, err := parseQIFDate(record['D'], opts.DayFirstDates)
+	if err != nil {
+		return txn, err.Error()
+	}
+
+	raw, ok := record['T']
+	if !ok {
+		raw = record['U']
+	}
+	amount, err := ParseAmount(raw, guessDecimalSeparator(raw))
+	if err != nil {
+		return txn, err.Error()
+	}
+
+	payee, memo := record['P'], record['M']
+	description := payee
+	if memo != "" && !strings.EqualFold(memo, payee) {
+		description = strings.TrimSpace(payee + " " + memo)
+	}
+	if description == "" {
+		description = record['L']
+	}
+	if description == "" {
+		return txn, "transaction has no payee, memo or category"
+	}
+
+	txn.TransactionDate = date
+	txn.Amount = amount
+	txn.Description = description
+	txn.CounterpartyName = payee
+	return txn, ""
+}
+
+// parseQIFDate reads the many date spellings QIF writers use: "1/31/2026", "1/31'26",
+// "01-31-26", "2026-01-31" and, with dayFirst, "31/01/2026" or "31.01.26"
+func parseQIFDate(value string, dayFirst bool) (time.Time, error) {
+	invalid := fmt.Errorf("invalid date %q", value)
+
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return r == '/' || r == '-' || r == '.' || r == '\'' || r == ' '
+	})
+	if len(parts) != 3 {
+		return time.Time{}, invalid
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, invalid
+		}
+		numbers[i] = n
+	}
+
+	var year, month, day int
+	switch {
+	case len(parts[0]) == 4:
+		year, month, day = numbers[0], numbers[1], numbers[2]
+	case dayFirst:
+		day, month, year = numbers[0], numbers[1], numbers[2]
+	default:
+		month, day, year = numbers[0], numbers[1], numbers[2]
+	}
+
+	// Quicken marks years from 2000 with an apostrophe ("1/31'26"); otherwise pivot at 70
+	if len(parts[2]) <= 2 && len(parts[0]) != 4 {
+		if strings.Contains(value, "'") || year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, invalid
+	}
+	return date, nil
+}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQIF(t *testing.T) {
+	type row struct {
+		line         int
+		date         time.Time
+		amount       int64
+		description  string
+		counterparty string
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		opts       Options
+		want       []row
+		wantErrors []int
+		wantFail   bool
+	}{
+		{
+			name: "bank account",
+			input: "\ufeff!Type:Bank\r\n" +
+				"D1/31'26\r\nT-1,234.50\r\nPLandlord\r\nMJanuary rent\r\nLHousing\r\n^\r\n" +
+				"D2026-02-01\r\nU100.00\r\nPEmployer\r\nMemployer\r\n^\r\n",
+			want: []row{
+				{2, date(2026, 1, 31), -123450, "Landlord January rent", "Landlord"},
+				{8, date(2026, 2, 1), 10000, "Employer", "Employer"},
+			},
+		},
+		{
+			name:  "day-first dates and category fallback",
+			input: "!Type:CCard\nD31.01.26\nT-12,50\nLDining\n^\n",
+			opts:  Options{DayFirstDates: true},
+			want:  []row{{2, date(2026, 1, 31), -1250, "Dining", ""}},
+		},
+		{
+			name: "non-account sections are skipped",
+			input: "!Type:Cat\nNGroceries\nE\n^\n" +
+				"!Type:Invst\nD1/2/26\nT5.00\nPBroker\n^\n" +
+				"!Type:Oth A\nD1/3/26\nT7.00\nPCash box\n^\n",
+			want: []row{{11, date(2026, 1, 3), 700, "Cash box", "Cash box"}},
+		},
+		{
+			name:       "bad records are reported",
+			input:      "!Type:Bank\nD2/30/2026\nT1.00\nPBad date\n^\nD1/1/2026\nTabc\nPBad amount\n^\nD1/1/2026\nT1.00\n^\n",
+			wantErrors: []int{2, 6, 10},
+		},
+		{
+			name:  "Windows-1252 payee",
+			input: "!Type:Bank\nD01/05/26\nT-3.20\nPCaf\xe9 \x80uro\n^\n",
+			want:  []row{{2, date(2026, 1, 5), -320, "Café €uro", "Café €uro"}},
+		},
+		{
+			name:     "not QIF",
+			input:    "Date,Amount\n1/1/2026,1.00\n",
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseQIF(strings.NewReader(tt.input), tt.opts)
+		if tt.wantFail {
+			if err == nil {
+				t.Errorf("%s: ParseQIF() succeeded, want an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ParseQIF() returned error: %v", tt.name, err)
+			continue
+		}
+
+		if len(result.Transactions) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d: %+v", tt.name, len(result.Transactions), len(tt.want), result.Transactions)
+			continue
+		}
+		for i, want := range tt.want {
+			got := result.Transactions[i]
+			if result.Rows[i] != want.line || !got.TransactionDate.Equal(want.date) || got.Amount != want.amount ||
+				got.Description != want.description || got.CounterpartyName != want.counterparty {
+				t.Errorf("%s: transaction %d = row %d %+v, want %+v", tt.name, i, result.Rows[i], got, want)
+			}
+		}
+		if got := errorRows(result); !slices.Equal(got, tt.wantErrors) {
+			t.Errorf("%s: errors on rows %v, want %v (%+v)", tt.name, got, tt.wantErrors, result.Errors)
+		}
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value    string
+		dayFirst bool
+		want     time.Time
+		wantErr  bool
+	}{
+		{value: "1/31/2026", want: date(2026, 1, 31)},
+		{value: "1/31'26", want: date(2026, 1, 31)},
+		{value: "01-31-26", want: date(2026, 1, 31)},
+		{value: "12/31/99", want: date(1999, 12, 31)},
+		{value: "2026-01-31", want: date(2026, 1, 31)},
+		{value: "2026-01-31", dayFirst: true, want: date(2026, 1, 31)},
+		{value: "31/01/2026", dayFirst: true, want: date(2026, 1, 31)},
+		{value: "03/04/2026", dayFirst: true, want: date(2026, 4, 3)},
+		{value: "03/04/2026", want: date(2026, 3, 4)},
+		{value: "31/01/2026", wantErr: true},
+		{value: "2/29/2026", wantErr: true},
+		{value: "1/31", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseQIFDate(tt.value, tt.dayFirst)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseQIFDate(%q, %v) = %v, want an error", tt.value, tt.dayFirst, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseQIFDate(%q, %v) returned error: %v", tt.value, tt.dayFirst, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseQIFDate(%q, %v) = %v, want %v", tt.value, tt.dayFirst, got, tt.want)
+		}
+	}
+}
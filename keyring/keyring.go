@@ -0,0 +1,219 @@
+// Package keyring holds the keys moneyd signs and verifies JWTs with.
+//
+// Keys are PEM files in a directory, named <kid>.pem for private keys (PKCS#8 RSA or Ed25519,
+// or PKCS#1 RSA) and <kid>.pub.pem for public keys kept only to verify tokens signed before a
+// rotation. New tokens are signed with JWT_SIGNING_KID when set, otherwise with the private key
+// whose kid sorts last, so date-based names like 2026-10.pem rotate naturally:
+//
+//	openssl genpkey -algorithm ed25519 -out keys/2026-10.pem
+//
+// Without a key directory the ring falls back to HS256 with JWT_SECRET. Once a directory is in
+// use, HS256 tokens are only accepted until JWT_SECRET_ACCEPT_UNTIL, so tokens issued before the
+// switch survive it without the old secret staying good for minting tokens forever.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const Issuer = "moneyd"
+
+type key struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+type KeyRing struct {
+	dir          string
+	signingKid   string
+	legacySecret []byte
+	// legacyUntil is when HS256 tokens stop being accepted alongside a key directory
+	legacyUntil time.Time
+
+	mu      sync.RWMutex
+	signing *key
+	keys    map[string]*key
+}
+
+// Load reads every key in dir. signingKid may be empty to pick the newest private key. With a
+// key directory, tokens signed with legacySecret are accepted until legacyUntil; a zero
+// legacyUntil rejects them outright.
+func Load(dir string, signingKid string, legacySecret []byte, legacyUntil time.Time) (*KeyRing, error) {
+	ring := &KeyRing{dir: dir, signingKid: signingKid, legacySecret: legacySecret, legacyUntil: legacyUntil}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Reload re-reads the key directory, picking up added or removed keys. On error the
+// previously loaded keys stay in use.
+func (r *KeyRing) Reload() error {
+	if r.dir == "" {
+		if len(r.legacySecret) == 0 {
+			return errors.New("keyring: neither a key directory nor a JWT secret is configured")
+		}
+		r.mu.Lock()
+		r.signing = nil
+		r.keys = map[string]*key{}
+		r.mu.Unlock()
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*key{}
+	var privateKids []string
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return fmt.Errorf("keyring: %s: %w", path, err)
+		}
+		if existing, ok := keys[k.kid]; ok && existing.private != nil {
+			continue
+		}
+		keys[k.kid] = k
+		if k.private != nil {
+			privateKids = append(privateKids, k.kid)
+		}
+	}
+
+	signingKid := r.signingKid
+	if signingKid == "" && len(privateKids) > 0 {
+		sort.Strings(privateKids)
+		signingKid = privateKids[len(privateKids)-1]
+	}
+	signing, ok := keys[signingKid]
+	if !ok || signing.private == nil {
+		return fmt.Errorf("keyring: no private key %q in %s", signingKid, r.dir)
+	}
+
+	r.mu.Lock()
+	r.signing = signing
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	name := filepath.Base(path)
+	k := &key{kid: strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, typed, &typed.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, typed
+	case ed25519.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodEdDSA, typed, typed.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = jwt.SigningMethodEdDSA, typed
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return k, nil
+}
+
+// Sign issues a token over claims using the current signing key
+func (r *KeyRing) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = Issuer
+
+	r.mu.RLock()
+	signing := r.signing
+	r.mu.RUnlock()
+
+	if signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.legacySecret)
+	}
+
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.kid
+	return token.SignedString(signing.private)
+}
+
+// acceptsLegacy reports whether HS256 tokens signed with the legacy secret are still valid
+func (r *KeyRing) acceptsLegacy() bool {
+	if len(r.legacySecret) == 0 {
+		return false
+	}
+	return r.dir == "" || time.Now().Before(r.legacyUntil)
+}
+
+// Parse verifies a token against whichever key its kid names, and checks it was issued by
+// moneyd. The algorithm is always taken from the key, never trusted from the token header.
+func (r *KeyRing) Parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, hasKid := token.Header["kid"].(string)
+		if !hasKid {
+			if r.acceptsLegacy() && token.Method == jwt.SigningMethodHS256 {
+				return r.legacySecret, nil
+			}
+			return nil, errors.New("token has no kid")
+		}
+
+		r.mu.RLock()
+		k, ok := r.keys[kid]
+		r.mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return k.public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if !claims.VerifyIssuer(Issuer, true) {
+		return nil, errors.New("token was not issued by " + Issuer)
+	}
+	return claims, nil
+}
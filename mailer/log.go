@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// LogMailer is for local development. Messages are written as .eml files under Dir, or
+// printed to the server log when Dir is empty, so links can be followed without a mail server.
+type LogMailer struct {
+	Dir string
+	seq atomic.Int64
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("mail to=%q subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage("moneyd@localhost", msg), 0o644)
+}
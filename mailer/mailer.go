@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"log"
+	"os"
+	"strconv"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain-text messages to users
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FromEnv picks a mailer based on MAILER. "smtp" sends real mail using the SMTP_* variables;
+// anything else falls back to the log mailer, which writes messages to MAIL_DIR when set.
+func FromEnv() Mailer {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			log.Fatal("Invalid SMTP_PORT")
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	default:
+		return &LogMailer{Dir: os.Getenv("MAIL_DIR")}
+	}
+}
@@ -1,19 +1,32 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"database/sql"
-	"fmt"
+	"encoding/hex"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/joho/godotenv"
+	"hash"
+	"io"
 	"log"
 	"moneyd/api/database"
 	"moneyd/api/handlers"
+	"moneyd/api/keyring"
+	"moneyd/api/mailer"
+	"moneyd/api/models"
+	"moneyd/api/oidc"
+	"moneyd/api/utils"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"time"
 	"strings"
+	"syscall"
 )
 
 var db *sql.DB
@@ -33,60 +46,218 @@ func main() {
 		log.Fatal("Error loading env vars.")
 	}
 
-	expectedJwtSecret := os.Getenv("JWT_SECRET")
-	expectedApiKey := os.Getenv("API_KEY")
+	argon2Params, err := utils.Argon2ParamsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	utils.SetArgon2Params(argon2Params)
+
+	// After moving to JWT_KEY_DIR, tokens signed with JWT_SECRET keep working only until this time
+	var legacyTokensUntil time.Time
+	if until := os.Getenv("JWT_SECRET_ACCEPT_UNTIL"); until != "" {
+		legacyTokensUntil, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			log.Fatal("JWT_SECRET_ACCEPT_UNTIL must be an RFC 3339 time, such as 2026-11-01T00:00:00Z")
+		}
+	}
+	keys, err := keyring.Load(os.Getenv("JWT_KEY_DIR"), os.Getenv("JWT_SIGNING_KID"), []byte(os.Getenv("JWT_SECRET")), legacyTokensUntil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reloadKeysOnHangup(keys)
+
+	// API_KEY is the old shared key, still honoured so clients can move to per-client keys gradually
+	legacyApiKey := os.Getenv("API_KEY")
+	if legacyApiKey != "" {
+		log.Print("API_KEY is set; the shared key is deprecated in favour of per-client keys")
+	}
+	requireApiKey := apiKeyMiddleware(legacyApiKey, db)
+	mail := mailer.FromEnv()
+
+	duplicatePolicy := os.Getenv("DUPLICATE_POLICY")
+	if duplicatePolicy == "" {
+		duplicatePolicy = models.DuplicatePolicySkip
+	}
+	if !slices.Contains(models.DuplicatePolicies, duplicatePolicy) {
+		log.Fatalf("DUPLICATE_POLICY must be one of %s", strings.Join(models.DuplicatePolicies, ", "))
+	}
+
+	idempotencyWindow := 24 * time.Hour
+	if hours := os.Getenv("IDEMPOTENCY_WINDOW_HOURS"); hours != "" {
+		parsed, err := strconv.Atoi(hours)
+		if err != nil || parsed <= 0 {
+			log.Fatal("IDEMPOTENCY_WINDOW_HOURS must be a positive number of hours")
+		}
+		idempotencyWindow = time.Duration(parsed) * time.Hour
+	}
+	go purgeIdempotencyKeys(db)
+
+	dataExportDir := os.Getenv("DATA_EXPORT_DIR")
+	if dataExportDir == "" {
+		dataExportDir = filepath.Join(os.TempDir(), "moneyd-exports")
+	}
+	if err := os.MkdirAll(dataExportDir, 0700); err != nil {
+		log.Fatal("DATA_EXPORT_DIR: ", err)
+	}
+	if interrupted, err := database.FailInterruptedDataExports(db); err != nil {
+		log.Print(err)
+	} else if interrupted > 0 {
+		log.Printf("Marked %d interrupted data exports as failed", interrupted)
+	}
+	handlers.RemoveUnfinishedDataExportFiles(dataExportDir)
+	go purgeDataExports(db)
 
 	config.AllowOrigins = []string{"http://localhost:8085", 
 	"http://192.168.1.54", 
 	"http://127.0.0.1",
 	"http://localhost:5173"}
 	config.AllowMethods = []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "Idempotency-Key"}
 	router.Use(cors.New(config))
 
 //	router.POST("/test/genhash", handlers.HashTest())
 
-	router.POST("/auth/login", apiKeyMiddleware(expectedApiKey), handlers.LoginHandler(db))
-	router.GET("/auth/me", apiKeyMiddleware(expectedApiKey), AuthMiddleware([]byte(expectedJwtSecret)), handlers.GetUserInfoHandler(db))
+	router.GET("/.well-known/jwks.json", handlers.JWKSHandler(keys))
+
+	router.POST("/auth/login", requireApiKey, handlers.LoginHandler(db, keys))
+	router.POST("/auth/refresh", requireApiKey, handlers.RefreshHandler(db, keys))
+	router.POST("/auth/logout", requireApiKey, AuthMiddleware(keys, db), handlers.LogoutHandler(db))
+	router.GET("/auth/me", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeRead), handlers.GetUserInfoHandler(db))
+
+	router.POST("/auth/password-reset/request", requireApiKey, handlers.PasswordResetRequestHandler(db, mail))
+	router.POST("/auth/password-reset/confirm", requireApiKey, handlers.PasswordResetConfirmHandler(db))
+	router.POST("/auth/verify-email/request", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeAccount), handlers.EmailVerificationRequestHandler(db, mail))
+	router.POST("/auth/verify-email/confirm", requireApiKey, handlers.EmailVerificationConfirmHandler(db))
+
+	router.POST("/auth/mfa/verify", requireApiKey, handlers.MfaVerifyHandler(db, keys))
+
+	mfa := router.Group("/auth/mfa/totp", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeAccount))
+	{
+		mfa.POST("/enroll", handlers.TotpEnrollHandler(db))
+		mfa.POST("/confirm", handlers.TotpConfirmHandler(db))
+		mfa.DELETE("", handlers.TotpDisableHandler(db))
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		})
+		allowSignup := os.Getenv("OIDC_ALLOW_SIGNUP") == "true"
+
+		router.POST("/auth/oidc/start", requireApiKey, handlers.OidcStartHandler(db, provider))
+		router.POST("/auth/oidc/callback", requireApiKey, handlers.OidcCallbackHandler(db, keys, provider, allowSignup))
+	}
+
+	sessions := router.Group("/auth/sessions", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeAccount))
+	{
+		sessions.GET("", handlers.ListSessionsHandler(db))
+		sessions.DELETE("", handlers.RevokeAllSessionsHandler(db))
+		sessions.DELETE("/:id", handlers.RevokeSessionHandler(db))
+	}
+
+	tokens := router.Group("/auth/tokens", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeAccount))
+	{
+		tokens.GET("", handlers.ListPersonalAccessTokensHandler(db))
+		tokens.POST("", handlers.CreatePersonalAccessTokenHandler(db))
+		tokens.DELETE("/:id", handlers.DeleteHandlerAuthorized(database.RevokePersonalAccessTokenAuthorized, db))
+	}
+
+	account := router.Group("/account", requireApiKey, AuthMiddleware(keys, db), RequireScope(models.ScopeAccount))
+	{
+		account.GET("/exports", handlers.ListDataExportsHandler(db))
+		account.POST("/exports", handlers.RequestDataExportHandler(db, dataExportDir))
+		account.GET("/exports/:id", handlers.GetDataExportHandler(db))
+		account.GET("/exports/:id/download", handlers.DownloadDataExportHandler(db))
+		account.POST("/restore", handlers.RestoreDataExportHandler(db))
+	}
 
 	api := router.Group("/api")
 	api.GET("/test", testHandler)
 
-	api.POST("/users", apiKeyMiddleware(expectedApiKey), handlers.CreateHandler(database.CreateUser, db))
+	api.POST("/users", requireApiKey, handlers.CreateHandler(database.CreateUser, db))
 	// Authorization checks implemented - users can only access their own data
-	api.Use(apiKeyMiddleware(expectedApiKey), AuthMiddleware([]byte(expectedJwtSecret)))
+	api.Use(requireApiKey, AuthMiddleware(keys, db), idempotencyMiddleware(db, idempotencyWindow))
 	{
-		api.GET("/users/:id", handlers.GetHandlerAuthorized(database.GetUserAuthorized, db))
-		api.PUT("/users/:id", handlers.UpdateHandlerAuthorized(database.UpdateUserAuthorized, db))
-		api.DELETE("/users/:id", handlers.DeleteHandlerAuthorized(database.DeleteUserAuthorized, db))
+		// Each group demands the scope a personal access token needs to reach it; sessions carry every scope
+		read := api.Group("", RequireScope(models.ScopeRead))
+		{
+			read.GET("/users/:id", handlers.GetHandlerAuthorized(database.GetUserAuthorized, db))
+
+			read.GET("/statements/:id", handlers.GetHandlerAuthorized(database.GetStatementAuthorized, db))
+			read.GET("/statements/user/:id", handlers.GetHandlerByUserIdAuthorized(database.GetStatementsByUserIdAuthorized, db))
+
+			read.GET("/transactions/:id", handlers.GetHandlerAuthorized(database.GetTransactionAuthorized, db))
+			read.GET("/transactions/statement/:id", handlers.GetHandlerAuthorized(database.GetTransactionsByStatementIdAuthorized, db))
+			read.GET("/transactions/user/:id", handlers.ListTransactionsHandler(db))
+			read.GET("/transactions/search", handlers.SearchTransactionsHandler(db))
+			read.GET("/transactions/by_institution/user/:id1/institution/:id2", handlers.GetHandlerIndeterminiteArgsAuthorized(database.GetTransactionsByInstitutionIdAuthorized, db, 2, 0))
 
-		api.GET("/statements/:id", handlers.GetHandlerAuthorized(database.GetStatementAuthorized, db))
-		api.GET("/statements/user/:id", handlers.GetHandlerByUserIdAuthorized(database.GetStatementsByUserIdAuthorized, db))
-		api.POST("/statements", handlers.CreateHandlerAuthorized(database.CreateStatementAuthorized, db))
-		api.PUT("/statements/:id", handlers.UpdateHandlerAuthorized(database.UpdateStatementAuthorized, db))
-		api.DELETE("/statements/:id", handlers.DeleteHandlerAuthorized(database.DeleteStatementAuthorized, db))
+			read.GET("/transactions/import/mappings/:id", handlers.GetHandlerAuthorized(database.GetCsvColumnMappingAuthorized, db))
+			read.GET("/transactions/import/previews/:id", handlers.GetHandlerAuthorized(database.GetImportPreviewAuthorized, db))
+			read.GET("/transactions/export", handlers.ExportTransactionsHandler(db))
+			read.GET("/transactions/export/ledger-mapping", handlers.GetLedgerAccountMappingHandler(db))
 
-		api.GET("/transactions/:id", handlers.GetHandlerAuthorized(database.GetTransactionAuthorized, db))
-		api.GET("/transactions/statement/:id", handlers.GetHandlerAuthorized(database.GetTransactionsByStatementIdAuthorized, db))
-		api.GET("/transactions/user/:id", handlers.GetHandlerByUserIdAuthorized(database.GetTransactionsByUserIdAuthorized, db))
-		api.GET("/transactions/by_institution/user/:id1/institution/:id2", handlers.GetHandlerIndeterminiteArgsAuthorized(database.GetTransactionsByInstitutionIdAuthorized, db, 2, 0))
-		api.POST("/transactions", handlers.CreateHandlerAuthorized(database.CreateTransactionAuthorized, db))
-		api.POST("/transactions/batch", handlers.CreateBatchHandlerAuthorized(database.CreateTransactionsBatchAuthorized, db))
-		api.PUT("/transactions/:id", handlers.UpdateHandlerAuthorized(database.UpdateTransactionAuthorized, db))
-		api.DELETE("/transactions/:id", handlers.DeleteHandlerAuthorized(database.DeleteTransactionAuthorized, db))
+			read.GET("/institutions", handlers.GetGenericHandler(database.GetInstitutions, db))
+			read.GET("/transactiontypes", handlers.GetGenericHandler(database.GetTransactionTypes, db))
+		}
+
+		account := api.Group("/users", RequireScope(models.ScopeAccount))
+		{
+			account.PUT("/:id", handlers.UpdateHandlerAuthorized(database.UpdateUserAuthorized, db))
+			account.DELETE("/:id", handlers.DeleteHandlerAuthorized(database.DeleteUserAuthorized, db))
+		}
 
-		api.GET("/institutions", handlers.GetGenericHandler(database.GetInstitutions, db))
-		api.GET("/transactiontypes", handlers.GetGenericHandler(database.GetTransactionTypes, db))
+		statements := api.Group("/statements", RequireScope(models.ScopeStatementsWrite))
+		{
+			statements.POST("", handlers.CreateHandlerAuthorized(database.CreateStatementAuthorized, db))
+			statements.PUT("/:id", handlers.UpdateHandlerAuthorized(database.UpdateStatementAuthorized, db))
+			statements.DELETE("/:id", handlers.DeleteHandlerAuthorized(database.DeleteStatementAuthorized, db))
+		}
 
+		transactions := api.Group("/transactions", RequireScope(models.ScopeTransactionsWrite))
+		{
+			transactions.POST("", handlers.CreateHandlerAuthorized(database.CreateTransactionAuthorized, db))
+			transactions.POST("/batch", handlers.CreateTransactionsBatchHandler(db, duplicatePolicy))
+			transactions.POST("/batch/preview", handlers.PreviewTransactionsBatchHandler(db))
+			transactions.POST("/batch/stream", handlers.StreamTransactionsHandler(db, duplicatePolicy))
+			transactions.POST("/import", handlers.ImportTransactionsHandler(db, duplicatePolicy))
+			transactions.POST("/import/previews/:id/commit", handlers.CommitImportPreviewHandler(db, duplicatePolicy))
+			transactions.PUT("/import/mappings/:id", handlers.SaveCsvColumnMappingHandler(db))
+			transactions.PUT("/export/ledger-mapping", handlers.SaveLedgerAccountMappingHandler(db))
+			transactions.PUT("/:id", handlers.UpdateHandlerAuthorized(database.UpdateTransactionAuthorized, db))
+			transactions.DELETE("/:id", handlers.DeleteHandlerAuthorized(database.DeleteTransactionAuthorized, db))
+		}
 	}
  
+	admin := router.Group("/admin", requireApiKey, AuthMiddleware(keys, db), AdminMiddleware())
+	{
+		admin.GET("/users", handlers.GetGenericHandler(database.GetUserSummaries, db))
+		admin.GET("/users/:id", handlers.AdminGetHandler(database.GetUserSummary, db))
+		admin.PUT("/users/:id", handlers.AdminUpdateHandler(database.AdminUpdateUser, db))
+
+		admin.GET("/institutions", handlers.GetGenericHandler(database.GetInstitutions, db))
+		admin.GET("/institutions/:id", handlers.AdminGetHandler(database.GetInstitution, db))
+		admin.POST("/institutions", handlers.AdminCreateHandler(database.CreateInstitution, db))
+		admin.PUT("/institutions/:id", handlers.AdminUpdateHandler(database.UpdateInstitution, db))
+		admin.DELETE("/institutions/:id", handlers.AdminDeleteHandler(database.DeleteInstitution, db))
+
+		admin.GET("/transactiontypes", handlers.GetGenericHandler(database.GetTransactionTypes, db))
+		admin.GET("/transactiontypes/:id", handlers.AdminGetHandler(database.GetTransactionType, db))
+		admin.POST("/transactiontypes", handlers.AdminCreateHandler(database.CreateTransactionType, db))
+		admin.PUT("/transactiontypes/:id", handlers.AdminUpdateHandler(database.UpdateTransactionType, db))
+		admin.DELETE("/transactiontypes/:id", handlers.AdminDeleteHandler(database.DeleteTransactionType, db))
+	}
+
 	log.Print("Setup complete...")
 	log.Print("Running...")
 
 	router.Run("0.0.0.0:8085")
 }
 
-func apiKeyMiddleware(expectedApiKey string) gin.HandlerFunc {
+func apiKeyMiddleware(legacyApiKey string, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		apiKey := c.GetHeader("X-API-Key")
 		if apiKey == "" {
@@ -95,17 +266,33 @@ func apiKeyMiddleware(expectedApiKey string) gin.HandlerFunc {
 			return
 		}
 
-		if apiKey != expectedApiKey {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
-			c.Abort()
+		if ident, ok := utils.ApiKeyIdent(apiKey); ok {
+			key, err := database.GetUsableApiClientKeyByPrefix(ident, db)
+			if err != nil && err != sql.ErrNoRows {
+				log.Print(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Abort()
+				return
+			}
+			if err == nil && utils.ConstantTimeEqual(utils.HashToken(apiKey), key.KeyHash) {
+				if err := database.TouchApiClientKey(key.ApiClientKeyId, db); err != nil {
+					log.Print(err)
+				}
+				c.Set("api_client_id", key.ApiClientId)
+				c.Next()
+				return
+			}
+		} else if legacyApiKey != "" && utils.ConstantTimeEqual(apiKey, legacyApiKey) {
+			c.Next()
 			return
 		}
 
-		c.Next()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
 	}
 }
 
-func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
+func AuthMiddleware(keys *keyring.KeyRing, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -116,22 +303,17 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 
 		// Extract token from "Bearer <token>"
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if token.Method != jwt.SigningMethodHS256 {
-				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
-			}
-			return jwtSecret, nil
-		})
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, tokenString, db)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Access tokens have no audience; any token that names one, such as an MFA challenge,
+		// was issued for something else
+		claims, err := keys.Parse(tokenString)
+		if err != nil || claims["aud"] != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
@@ -150,8 +332,247 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 			return
 		}
 		userID := int(claims["user_id"].(float64))
+
+		// Tokens are tied to a server-side session so logout and revocation take effect immediately
+		sid, ok := claims["sid"].(float64)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session claim"})
+			c.Abort()
+			return
+		}
+
+		session, err := database.GetActiveSession(int(sid), db)
+		if err != nil && err != sql.ErrNoRows {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if err == sql.ErrNoRows || session.BankingUserId != userID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or expired"})
+			c.Abort()
+			return
+		}
+
+		if err := database.TouchSession(session.AuthSessionId, c.ClientIP(), db); err != nil {
+			log.Print(err)
+		}
+
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = models.RoleUser
+		}
+
 		c.Set("user_id", userID)
+		c.Set("session_id", session.AuthSessionId)
+		c.Set("role", role)
+		c.Set("scopes", []string{models.ScopeAll})
+		c.Next()
+	}
+}
+
+func authenticatePersonalAccessToken(c *gin.Context, tokenString string, db *sql.DB) {
+	pat, err := database.GetActivePersonalAccessTokenByHash(utils.HashToken(tokenString), db)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		} else {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		}
+		c.Abort()
+		return
+	}
+
+	if err := database.TouchPersonalAccessToken(pat.PersonalAccessTokenId, db); err != nil {
+		log.Print(err)
+	}
+
+	c.Set("user_id", pat.BankingUserId)
+	c.Set("personal_access_token_id", pat.PersonalAccessTokenId)
+	c.Set("scopes", pat.Scopes)
+	c.Next()
+}
+
+// RequireScope rejects requests whose token was not granted scope. Must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := c.GetStringSlice("scopes")
+		if !slices.Contains(scopes, models.ScopeAll) && !slices.Contains(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing required scope " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware only lets through sessions whose token carries the admin role. Personal
+// access tokens never carry a role, so they can't reach admin routes. Must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// idempotencyResponseRecorder keeps a copy of everything a handler writes so it can be replayed
+type idempotencyResponseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyResponseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyResponseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyClaimLease is how long a request holds its Idempotency-Key before finishing. A claim
+// left behind by a crashed process is free again after this, rather than after the whole window.
+const idempotencyClaimLease = 5 * time.Minute
+
+// idempotencyMiddleware makes POST requests carrying an Idempotency-Key header safe to retry. The
+// first response per user and key is stored for window and replayed for later requests with the
+// same key; a different method, path or body under the same key is rejected. Server errors are
+// not stored, so those requests can be retried for real. Must run after AuthMiddleware.
+//
+// The body is hashed as it streams through to the handler rather than read up front, so streamed
+// and multipart uploads are never held in memory. That means the hash is only known once the
+// handler is done: the key is claimed first and the hash stored with the response.
+func idempotencyMiddleware(db *sql.DB, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		digest := sha256.New()
+		digest.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+
+		userID := c.GetInt("user_id")
+		idempotencyKeyId, err := database.ClaimIdempotencyKey(userID, key, idempotencyClaimLease, db)
+		if err == sql.ErrNoRows {
+			replayIdempotentResponse(c, userID, key, digest, db)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		// Unless a response is saved the key is released, including when the handler panics, so
+		// retries run the request again instead of waiting out the lease
+		saved := false
+		defer func() {
+			if saved {
+				return
+			}
+			if err := database.ReleaseIdempotencyKey(idempotencyKeyId, db); err != nil {
+				log.Printf("Could not release idempotency key %d: %v", idempotencyKeyId, err)
+			}
+		}()
+
+		body := c.Request.Body
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, digest), body}
+
+		recorder := &idempotencyResponseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
 		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		// A handler that answered without reading everything still has to hash the rest
+		if _, err := io.Copy(io.Discard, c.Request.Body); err != nil {
+			log.Print(err)
+			return
+		}
+		requestHash := hex.EncodeToString(digest.Sum(nil))
+		if err := database.SaveIdempotentResponse(idempotencyKeyId, requestHash, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes(), window, db); err != nil {
+			log.Printf("Could not save the response for idempotency key %d: %v", idempotencyKeyId, err)
+			return
+		}
+		saved = true
+	}
+}
+
+// replayIdempotentResponse answers a request whose key is already held. The body is only
+// streamed through digest once the earlier request has finished and there is a hash to compare.
+func replayIdempotentResponse(c *gin.Context, userID int, key string, digest hash.Hash, db *sql.DB) {
+	defer c.Abort()
+
+	record, err := database.GetIdempotencyKey(userID, key, db)
+	if err != nil || record.ResponseStatus == 0 {
+		// Either the earlier request is still running or it was released between our claim and
+		// this read; either way the client should retry
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	if _, err := io.Copy(digest, c.Request.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read request body"})
+		return
+	}
+	if !utils.ConstantTimeEqual(record.RequestHash, hex.EncodeToString(digest.Sum(nil))) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.ResponseStatus, record.ResponseContentType, record.ResponseBody)
+}
+
+// purgeIdempotencyKeys periodically deletes idempotency keys whose replay window has passed
+func purgeIdempotencyKeys(db *sql.DB) {
+	for range time.Tick(time.Hour) {
+		if _, err := database.DeleteExpiredIdempotencyKeys(db); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// purgeDataExports periodically deletes account data archives whose download window has passed
+func purgeDataExports(db *sql.DB) {
+	for range time.Tick(time.Hour) {
+		paths, err := database.DeleteExpiredDataExports(db)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		handlers.RemoveDataExportFiles(paths)
+	}
+}
+
+// reloadKeysOnHangup re-reads the JWT key directory on SIGHUP so keys can be rotated without a restart
+func reloadKeysOnHangup(keys *keyring.KeyRing) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		if err := keys.Reload(); err != nil {
+			log.Print(err)
+			continue
+		}
+		log.Print("Reloaded JWT keys")
 	}
 }
 
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+type ApiClient struct {
+	ApiClientId		int			`json:"api_client_id"`
+	Name			string		`json:"name"`
+	Enabled			bool		`json:"enabled"`
+	DateCreated		time.Time	`json:"date_created"`
+}
+
+type ApiClientKey struct {
+	ApiClientKeyId	int			`json:"api_client_key_id"`
+	ApiClientId		int			`json:"api_client_id"`
+	Name			string		`json:"name"`
+	KeyPrefix		string		`json:"key_prefix"`
+	KeyHash			string		`json:"-"`
+	Enabled			bool		`json:"enabled"`
+	ValidFrom		time.Time	`json:"valid_from"`
+	ValidUntil		*time.Time	`json:"valid_until"`
+	LastUsedAt		*time.Time	`json:"last_used_at"`
+	DateCreated		time.Time	`json:"date_created"`
+}
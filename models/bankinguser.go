@@ -4,11 +4,29 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type BankingUser struct {
 	BankingUserId		int 		`json:"banking_user_id"`
 	Username			string		`json:"username"`
 	Email				string 		`json:"email"`
 	PasswordHash		string		`json:"password_hash"`
+	Role				string		`json:"role"`
+	DisabledAt			*time.Time	`json:"disabled_at"`
+	DateCreated			time.Time	`json:"date_created"`
+	DateUpdated			time.Time	`json:"date_updated"`
+}
+
+// UserSummary is what administrators see about a user; it never carries credentials
+type UserSummary struct {
+	BankingUserId		int 		`json:"banking_user_id"`
+	Username			string		`json:"username"`
+	Email				string 		`json:"email"`
+	Role				string		`json:"role"`
+	Disabled			bool		`json:"disabled"`
 	DateCreated			time.Time	`json:"date_created"`
 	DateUpdated			time.Time	`json:"date_updated"`
 }
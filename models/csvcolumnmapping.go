@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	AmountSignAsIs     = "as_is"
+	AmountSignInverted = "inverted"
+)
+
+// CsvColumnMapping describes one institution's CSV export. Columns are named by header when
+// the file has one, otherwise by zero-based index ("0", "1", ...). Either AmountColumn or the
+// DebitColumn/CreditColumn pair must be set.
+type CsvColumnMapping struct {
+	CsvColumnMappingId			int			`json:"csv_column_mapping_id"`
+	BankingUserId				int			`json:"banking_user_id"`
+	InstitutionId				int			`json:"institution_id"`
+	HasHeader					bool		`json:"has_header"`
+	Delimiter					string		`json:"delimiter"`
+	SkipRows					int			`json:"skip_rows"`
+	DateColumn					string		`json:"date_column"`
+	DateFormat					string		`json:"date_format"`
+	AmountColumn				string		`json:"amount_column"`
+	DebitColumn					string		`json:"debit_column"`
+	CreditColumn				string		`json:"credit_column"`
+	AmountSign					string		`json:"amount_sign"`
+	DecimalSeparator			string		`json:"decimal_separator"`
+	DescriptionColumns			[]string	`json:"description_columns"`
+	DebitTransactionTypeCode	int			`json:"debit_transaction_type_code"`
+	CreditTransactionTypeCode	int			`json:"credit_transaction_type_code"`
+	DateCreated					time.Time	`json:"date_created"`
+	DateUpdated					time.Time	`json:"date_updated"`
+}
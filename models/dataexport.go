@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	DataExportPending	= "pending"
+	DataExportComplete	= "complete"
+	DataExportFailed	= "failed"
+)
+
+// DataExportSchemaVersion is written to every archive's manifest and bumped whenever the layout
+// of the files inside changes
+const DataExportSchemaVersion = 1
+
+// DataExport is one requested account data archive. The archive itself is only served by the
+// download endpoint; DownloadUrl is set once it is ready.
+type DataExport struct {
+	DataExportId	int			`json:"data_export_id"`
+	BankingUserId	int			`json:"banking_user_id"`
+	Status			string		`json:"status"`
+	Error			string		`json:"error,omitempty"`
+	ArchiveSize		int64		`json:"archive_size,omitempty"`
+	DownloadUrl		string		`json:"download_url,omitempty"`
+	ExpiresAt		*time.Time	`json:"expires_at"`
+	DateCreated		time.Time	`json:"date_created"`
+	DateCompleted	*time.Time	`json:"date_completed"`
+}
+
+// DataExportManifest is manifest.json at the root of an archive
+type DataExportManifest struct {
+	Format			string			`json:"format"`
+	SchemaVersion	int				`json:"schema_version"`
+	BankingUserId	int				`json:"banking_user_id"`
+	GeneratedAt		time.Time		`json:"generated_at"`
+	Counts			map[string]int	`json:"counts"`
+}
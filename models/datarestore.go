@@ -0,0 +1,23 @@
+package models
+
+// DataRestore is what a restore reads from an export archive before its transactions, which are
+// streamed separately
+type DataRestore struct {
+	Institutions			[]Institution
+	Statements				[]Statement
+	CsvColumnMappings		[]CsvColumnMapping
+	LedgerAccountMapping	*LedgerAccountMapping
+}
+
+// DataRestoreResult reports what a restore created. InstitutionIds and StatementIds map the IDs in
+// the archive to the ones on this server; NotRestored lists what the archive held but a restore
+// deliberately leaves out.
+type DataRestoreResult struct {
+	Statements				int				`json:"statements"`
+	Transactions			int				`json:"transactions"`
+	CsvColumnMappings		int				`json:"csv_column_mappings"`
+	LedgerAccountMapping	bool			`json:"ledger_account_mapping"`
+	InstitutionIds			map[int]int		`json:"institution_ids"`
+	StatementIds			map[int]int		`json:"statement_ids"`
+	NotRestored				[]string		`json:"not_restored"`
+}
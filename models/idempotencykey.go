@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey records the first request a user sent with an Idempotency-Key header and, once
+// it finished, the response to replay. ResponseStatus is zero and RequestHash empty while the
+// request is in flight.
+type IdempotencyKey struct {
+	IdempotencyKeyId		int			`json:"idempotency_key_id"`
+	BankingUserId			int			`json:"banking_user_id"`
+	Key						string		`json:"idempotency_key"`
+	RequestHash				string		`json:"-"`
+	ResponseStatus			int			`json:"response_status"`
+	ResponseContentType		string		`json:"-"`
+	ResponseBody			[]byte		`json:"-"`
+	ExpiresAt				time.Time	`json:"expires_at"`
+	DateCreated				time.Time	`json:"date_created"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportRowError explains why one row of an import could not become a transaction. Row is the
+// 1-based line number for line-oriented formats such as CSV, and the 1-based position of the
+// transaction entry for document formats such as OFX and for JSON batches.
+type ImportRowError struct {
+	Row		int		`json:"row"`
+	Reason	string	`json:"reason"`
+}
+
+// ImportRow is a valid row of an import. DuplicateOf names an existing transaction the row
+// probably repeats.
+type ImportRow struct {
+	Row				int			`json:"row"`
+	Transaction		Transaction	`json:"transaction"`
+	DuplicateOf		int			`json:"duplicate_of,omitempty"`
+}
+
+// ImportPreview is a parsed import held until the user commits it. Statement is set for file
+// imports, where every row goes to one statement; a zero StatementId means it will be matched
+// or created on commit. CsvColumnMapping is a mapping the upload asked to save; it is saved for
+// its institution only when the preview is committed.
+type ImportPreview struct {
+	ImportPreviewId		int					`json:"import_preview_id"`
+	BankingUserId		int					`json:"banking_user_id"`
+	Statement			*Statement			`json:"statement,omitempty"`
+	CsvColumnMapping	*CsvColumnMapping	`json:"csv_column_mapping,omitempty"`
+	Rows			[]ImportRow			`json:"rows"`
+	Errors			[]ImportRowError	`json:"errors"`
+	ExpiresAt		time.Time			`json:"expires_at"`
+	CommittedAt		*time.Time			`json:"committed_at"`
+	DateCreated		time.Time			`json:"date_created"`
+}
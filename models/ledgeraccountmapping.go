@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// LedgerAccountMapping names the accounts a user's transactions land in when exported to Ledger,
+// hledger or Beancount. Each transaction posts between its institution's account and the account
+// for its transaction type; anything left unmapped gets an account named after the institution or
+// type. Map keys are institution IDs and transaction_type_lookup codes.
+type LedgerAccountMapping struct {
+	LedgerAccountMappingId	int				`json:"ledger_account_mapping_id"`
+	BankingUserId			int				`json:"banking_user_id"`
+	Currency				string			`json:"currency"`
+	InstitutionAccounts		map[int]string	`json:"institution_accounts"`
+	TransactionTypeAccounts	map[int]string	`json:"transaction_type_accounts"`
+	DateCreated				time.Time		`json:"date_created"`
+	DateUpdated				time.Time		`json:"date_updated"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type UserMfa struct {
+	BankingUserId	int				`json:"banking_user_id"`
+	TotpSecret		string			`json:"-"`
+	LastUsedStep	int64			`json:"-"`
+	EnabledAt		sql.NullTime	`json:"-"`
+	DateCreated		time.Time		`json:"date_created"`
+	DateUpdated		time.Time		`json:"date_updated"`
+}
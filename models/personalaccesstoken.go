@@ -0,0 +1,34 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Scopes gate what a bearer token may do. Personal access tokens carry a subset of the
+// grantable scopes; interactive sessions carry ScopeAll.
+const (
+	ScopeAll               = "*"
+	ScopeRead              = "read"
+	ScopeStatementsWrite   = "statements:write"
+	ScopeTransactionsWrite = "transactions:write"
+	// ScopeAccount covers credentials and profile changes and is never granted to a token
+	ScopeAccount = "account"
+)
+
+var GrantableScopes = []string{ScopeRead, ScopeStatementsWrite, ScopeTransactionsWrite}
+
+const PersonalAccessTokenPrefix = "mdp_"
+
+type PersonalAccessToken struct {
+	PersonalAccessTokenId	int				`json:"personal_access_token_id"`
+	BankingUserId			int				`json:"banking_user_id"`
+	Name					string			`json:"name"`
+	TokenHash				string			`json:"-"`
+	TokenPrefix				string			`json:"token_prefix"`
+	Scopes					[]string		`json:"scopes"`
+	ExpiresAt				*time.Time		`json:"expires_at"`
+	LastUsedAt				*time.Time		`json:"last_used_at"`
+	RevokedAt				sql.NullTime	`json:"-"`
+	DateCreated				time.Time		`json:"date_created"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type AuthSession struct {
+	AuthSessionId		int				`json:"auth_session_id"`
+	BankingUserId		int				`json:"banking_user_id"`
+	RefreshTokenHash	string			`json:"-"`
+	UserAgent			string			`json:"user_agent"`
+	IpAddress			string			`json:"ip_address"`
+	LastUsedAt			time.Time		`json:"last_used_at"`
+	ExpiresAt			time.Time		`json:"expires_at"`
+	RevokedAt			sql.NullTime	`json:"-"`
+	DateCreated			time.Time		`json:"date_created"`
+	DateUpdated			time.Time		`json:"date_updated"`
+	Current				bool			`json:"current"`
+}
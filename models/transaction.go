@@ -12,6 +12,10 @@ type Transaction struct {
 	Description					string		`json:"description"`
 	Amount						int64		`json:"amount"`
 	TransactionDate				time.Time	`json:"transaction_date"`
+	ExternalId					string		`json:"external_id,omitempty"`
+	ValueDate					*time.Time	`json:"value_date,omitempty"`
+	CounterpartyName			string		`json:"counterparty_name,omitempty"`
+	CounterpartyAccount			string		`json:"counterparty_account,omitempty"`
 	DateAdded					time.Time	`json:"date_added"`
 	DateUpdated					time.Time	`json:"date_updated"`
 }
@@ -0,0 +1,47 @@
+package models
+
+const (
+	DuplicatePolicySkip = "skip"
+	DuplicatePolicyFlag = "flag"
+	DuplicatePolicyFail = "fail"
+)
+
+var DuplicatePolicies = []string{DuplicatePolicySkip, DuplicatePolicyFlag, DuplicatePolicyFail}
+
+// DuplicateRow is a submitted row whose fingerprint matches an existing transaction. Row is the
+// 1-based position of the row in the submitted batch.
+type DuplicateRow struct {
+	Row			int		`json:"row"`
+	DuplicateOf	int		`json:"duplicate_of"`
+}
+
+// TransactionBatchChunk reports one chunk of a batch insert. Inserted is the running total of
+// rows written so far, including this chunk.
+type TransactionBatchChunk struct {
+	Chunk		int		`json:"chunk"`
+	Rows		int		`json:"rows"`
+	Inserted	int		`json:"inserted"`
+}
+
+// TransactionBatchResult reports a batch insert under a duplicate policy. Skipped rows were not
+// inserted; flagged rows were inserted anyway. The whole batch is written in one database
+// transaction, so Chunks only ever describes a batch that was committed in full.
+type TransactionBatchResult struct {
+	Transactions	[]Transaction				`json:"transactions"`
+	Skipped			[]DuplicateRow				`json:"skipped"`
+	Flagged			[]DuplicateRow				`json:"flagged"`
+	Chunks			[]TransactionBatchChunk		`json:"chunks"`
+}
+
+// TransactionStreamSummary reports an NDJSON import. Row in each listed line is the 1-based line
+// number in the request body; Lines counts every line read, blank ones included.
+type TransactionStreamSummary struct {
+	Lines			int					`json:"lines"`
+	Inserted		int					`json:"inserted"`
+	Skipped			int					`json:"skipped"`
+	Flagged			int					`json:"flagged"`
+	Failed			int					`json:"failed"`
+	SkippedLines	[]DuplicateRow		`json:"skipped_lines"`
+	FlaggedLines	[]DuplicateRow		`json:"flagged_lines"`
+	FailedLines		[]ImportRowError	`json:"failed_lines"`
+}
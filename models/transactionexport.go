@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ExportFormatCsv			= "csv"
+	ExportFormatOfx			= "ofx"
+	ExportFormatLedger		= "ledger"
+	ExportFormatHledger		= "hledger"
+	ExportFormatBeancount	= "beancount"
+)
+
+var ExportFormats = []string{ExportFormatCsv, ExportFormatOfx, ExportFormatLedger, ExportFormatHledger, ExportFormatBeancount}
+
+// TransactionFilter narrows a user's transactions. Zero fields do not filter; From and To are
+// inclusive calendar dates compared against transaction_date, MinAmount and MaxAmount are
+// inclusive amounts in cents, and Search matches part of the description, ignoring case.
+type TransactionFilter struct {
+	StatementId					int			`json:"statement_id,omitempty"`
+	InstitutionId				int			`json:"institution_id,omitempty"`
+	TransactionTypeLookupCode	int			`json:"transaction_type_lookup_code,omitempty"`
+	From						*time.Time	`json:"from,omitempty"`
+	To							*time.Time	`json:"to,omitempty"`
+	MinAmount					*int64		`json:"min_amount,omitempty"`
+	MaxAmount					*int64		`json:"max_amount,omitempty"`
+	Search						string		`json:"search,omitempty"`
+}
+
+// ExportedTransaction is a transaction together with the institution of its statement
+type ExportedTransaction struct {
+	Transaction
+	InstitutionId	int		`json:"institution_id"`
+	InstitutionName	string	`json:"institution_name"`
+}
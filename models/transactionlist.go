@@ -0,0 +1,23 @@
+package models
+
+const (
+	TransactionSortDate			= "date"
+	TransactionSortAmount		= "amount"
+	TransactionSortDescription	= "description"
+	TransactionSortDateAdded	= "date_added"
+)
+
+var TransactionSorts = []string{TransactionSortDate, TransactionSortAmount, TransactionSortDescription, TransactionSortDateAdded}
+
+// TransactionSort orders a transaction listing by one field, with transaction_id breaking ties
+type TransactionSort struct {
+	Field		string	`json:"field"`
+	Descending	bool	`json:"descending"`
+}
+
+// TransactionPage is one page of a transaction listing. NextCursor fetches the page after it
+// and is empty on the last page.
+type TransactionPage struct {
+	Transactions	[]Transaction	`json:"transactions"`
+	NextCursor		string			`json:"next_cursor,omitempty"`
+}
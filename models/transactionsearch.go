@@ -0,0 +1,10 @@
+package models
+
+// TransactionSearchResult is a transaction matching a search, with its relevance and its free
+// text as HTML-escaped snippets in which the matched words are wrapped in <mark> tags
+type TransactionSearchResult struct {
+	Transaction
+	Rank					float64	`json:"rank"`
+	DescriptionSnippet		string	`json:"description_snippet"`
+	CounterpartySnippet		string	`json:"counterparty_snippet,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+type UserIdentity struct {
+	UserIdentityId	int			`json:"user_identity_id"`
+	BankingUserId	int			`json:"banking_user_id"`
+	Issuer			string		`json:"issuer"`
+	Subject			string		`json:"subject"`
+	Email			string		`json:"email"`
+	DateCreated		time.Time	`json:"date_created"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	UserTokenPasswordReset     = "password_reset"
+	UserTokenEmailVerification = "email_verification"
+)
+
+type UserToken struct {
+	UserTokenId		int				`json:"user_token_id"`
+	BankingUserId	int				`json:"banking_user_id"`
+	Purpose			string			`json:"purpose"`
+	TokenHash		string			`json:"-"`
+	ExpiresAt		time.Time		`json:"expires_at"`
+	UsedAt			sql.NullTime	`json:"-"`
+	DateCreated		time.Time		`json:"date_created"`
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// API keys look like mdk_<ident>_<secret>. The ident is stored in clear so a key can be found
+// without scanning every hash; only the hash of the whole key is kept.
+const (
+	apiKeyPrefix      = "mdk_"
+	apiKeyIdentLength = 8
+)
+
+// GenerateApiKey returns a new API key along with the ident used to look it up
+func GenerateApiKey() (string, string, error) {
+	ident, err := GenerateToken(6)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return apiKeyPrefix + ident + "_" + secret, ident, nil
+}
+
+// ApiKeyIdent extracts the lookup ident from a presented key, returning false for anything
+// that isn't shaped like a per-client key
+func ApiKeyIdent(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok || len(rest) <= apiKeyIdentLength+1 || rest[apiKeyIdentLength] != '_' {
+		return "", false
+	}
+	return rest[:apiKeyIdentLength], true
+}
+
+// ConstantTimeEqual compares two secrets without leaking how much of them matched
+func ConstantTimeEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
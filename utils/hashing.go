@@ -1,23 +1,168 @@
 package utils
 
 import (
-	"log"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func PasswordHasher(password string) string {
-	passbytes := []byte(password)
+// Argon2Params controls the cost of new password hashes. Existing hashes keep the parameters
+// they were created with and are upgraded the next time their owner logs in.
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	paramsMu      sync.RWMutex
+	currentParams = DefaultArgon2Params
+)
+
+var errInvalidHash = errors.New("password hash is not in a recognised format")
+
+// SetArgon2Params changes the parameters used for new hashes
+func SetArgon2Params(params Argon2Params) {
+	paramsMu.Lock()
+	currentParams = params
+	paramsMu.Unlock()
+}
+
+// Argon2ParamsFromEnv starts from the defaults and applies ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM when they are set
+func Argon2ParamsFromEnv() (Argon2Params, error) {
+	params := DefaultArgon2Params
+	for name, target := range map[string]*uint32{
+		"ARGON2_MEMORY_KIB": &params.Memory,
+		"ARGON2_ITERATIONS": &params.Iterations,
+	} {
+		if raw := os.Getenv(name); raw != "" {
+			value, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || value == 0 {
+				return params, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*target = uint32(value)
+		}
+	}
+	if raw := os.Getenv("ARGON2_PARALLELISM"); raw != "" {
+		value, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || value == 0 {
+			return params, fmt.Errorf("invalid ARGON2_PARALLELISM %q", raw)
+		}
+		params.Parallelism = uint8(value)
+	}
+	return params, nil
+}
+
+// HashPassword hashes a password with argon2id, encoded in the PHC string format
+func HashPassword(password string) (string, error) {
+	paramsMu.RLock()
+	params := currentParams
+	paramsMu.RUnlock()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// IsBcryptHash reports whether encoded is a legacy bcrypt hash rather than argon2id
+func IsBcryptHash(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword(passbytes, bcrypt.DefaultCost)
+// VerifyPassword checks a password against an argon2id or legacy bcrypt hash. needsRehash is
+// true when the password matched but the hash is bcrypt or uses outdated argon2 parameters.
+func VerifyPassword(password string, encoded string) (match bool, needsRehash bool, err error) {
+	if IsBcryptHash(encoded) {
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
 	if err != nil {
-		log.Fatal(err)
+		return false, false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+
+	paramsMu.RLock()
+	current := currentParams
+	paramsMu.RUnlock()
+	return true, params != current, nil
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errInvalidHash
 	}
 
-	// quick sanity check
-	err = bcrypt.CompareHashAndPassword(hashedPassword, passbytes)
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		log.Fatal("PASSWORD_MISMATCH ABORTING")
+		return params, nil, nil, errInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	// argon2.IDKey panics on zero parallelism, so parameters no valid hash could have are
+	// rejected here rather than taking the login request down
+	if params.Parallelism == 0 || params.Iterations == 0 || params.Memory < 8*uint32(params.Parallelism) || len(salt) == 0 || len(key) == 0 {
+		return params, nil, nil, errInvalidHash
 	}
 
-	return string(hashedPassword)
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
 }
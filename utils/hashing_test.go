@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2Params keep hashing fast in tests
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func useArgon2Params(t *testing.T, params Argon2Params) {
+	t.Helper()
+	paramsMu.RLock()
+	previous := currentParams
+	paramsMu.RUnlock()
+	SetArgon2Params(params)
+	t.Cleanup(func() { SetArgon2Params(previous) })
+}
+
+func TestHashPassword(t *testing.T) {
+	useArgon2Params(t, testArgon2Params)
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("HashPassword() = %q, want an argon2id PHC string with the current parameters", hash)
+	}
+	if other, _ := HashPassword("correct horse"); other == hash {
+		t.Error("HashPassword() returned the same hash twice, so the salt is not random")
+	}
+
+	tests := []struct {
+		name            string
+		password        string
+		wantMatch       bool
+		wantNeedsRehash bool
+	}{
+		{name: "right password", password: "correct horse", wantMatch: true},
+		{name: "wrong password", password: "correct horse "},
+		{name: "empty password", password: ""},
+	}
+	for _, tt := range tests {
+		match, needsRehash, err := VerifyPassword(tt.password, hash)
+		if err != nil || match != tt.wantMatch || needsRehash != tt.wantNeedsRehash {
+			t.Errorf("%s: VerifyPassword() = %v, %v, %v, want %v, %v, nil", tt.name, match, needsRehash, err, tt.wantMatch, tt.wantNeedsRehash)
+		}
+	}
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	useArgon2Params(t, testArgon2Params)
+	hash, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	useArgon2Params(t, stronger)
+
+	tests := []struct {
+		name            string
+		password        string
+		hash            string
+		wantMatch       bool
+		wantNeedsRehash bool
+	}{
+		{name: "argon2id with outdated parameters", password: "hunter2", hash: hash, wantMatch: true, wantNeedsRehash: true},
+		{name: "outdated argon2id, wrong password", password: "hunter3", hash: hash},
+		{name: "legacy bcrypt", password: "hunter2", hash: string(bcryptHash), wantMatch: true, wantNeedsRehash: true},
+		{name: "legacy bcrypt, wrong password", password: "hunter3", hash: string(bcryptHash)},
+	}
+	for _, tt := range tests {
+		match, needsRehash, err := VerifyPassword(tt.password, tt.hash)
+		if err != nil || match != tt.wantMatch || needsRehash != tt.wantNeedsRehash {
+			t.Errorf("%s: VerifyPassword() = %v, %v, %v, want %v, %v, nil", tt.name, match, needsRehash, err, tt.wantMatch, tt.wantNeedsRehash)
+		}
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "plain text", hash: "hunter2"},
+		{name: "argon2i", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "wrong version", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "missing key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "unparseable parameters", hash: "$argon2id$v=19$m=lots,t=1,p=1$" + salt + "$" + key},
+		{name: "zero parallelism", hash: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "zero iterations", hash: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "memory below 8 KiB per lane", hash: "$argon2id$v=19$m=15,t=1,p=2$" + salt + "$" + key},
+		{name: "empty salt", hash: "$argon2id$v=19$m=64,t=1,p=1$$" + key},
+		{name: "empty key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "bad base64", hash: "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key},
+	}
+
+	for _, tt := range tests {
+		match, _, err := VerifyPassword("hunter2", tt.hash)
+		if match || !errors.Is(err, errInvalidHash) {
+			t.Errorf("%s: VerifyPassword() = %v, %v, want false, errInvalidHash", tt.name, match, err)
+		}
+	}
+}
+
+func TestIsBcryptHash(t *testing.T) {
+	tests := []struct {
+		hash string
+		want bool
+	}{
+		{"$2a$10$abcdefghijklmnopqrstuv", true},
+		{"$2b$12$abcdefghijklmnopqrstuv", true},
+		{"$2y$10$abcdefghijklmnopqrstuv", true},
+		{"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsBcryptHash(tt.hash); got != tt.want {
+			t.Errorf("IsBcryptHash(%q) = %v, want %v", tt.hash, got, tt.want)
+		}
+	}
+}
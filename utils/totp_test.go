@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238 appendix B, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	// The RFC lists eight-digit codes; six-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := TotpCode(rfc6238Secret, TotpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Errorf("TotpCode at %d returned error: %v", tt.unix, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("TotpCode at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+
+	if got, err := TotpCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", 1); err != nil || got != "287082" {
+		t.Errorf("TotpCode with a lower case, padded secret = %q, %v", got, err)
+	}
+	if _, err := TotpCode("not base32!", 1); err == nil {
+		t.Error("TotpCode accepted a secret that is not base32")
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TotpStep(now)
+	code := func(step int64) string {
+		c, err := TotpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous step", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "surrounding spaces", code: " " + code(step) + " ", wantStep: step, wantOK: true},
+		{name: "two steps old", code: code(step - 2)},
+		{name: "two steps ahead", code: code(step + 2)},
+		{name: "too short", code: code(step)[:5]},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		gotStep, ok := ValidateTotp(rfc6238Secret, tt.code, now)
+		if ok != tt.wantOK || (ok && gotStep != tt.wantStep) {
+			t.Errorf("%s: ValidateTotp(%q) = %d, %v, want %d, %v", tt.name, tt.code, gotStep, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+}
+
+func TestGenerateTotpSecret(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateTotpSecret() = %q, which decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+}
+
+func TestTotpURI(t *testing.T) {
+	uri, err := url.Parse(TotpURI("moneyd", "ana@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/moneyd:ana@example.com" {
+		t.Errorf("TotpURI() = %s", uri)
+	}
+	query := uri.Query()
+	for name, want := range map[string]string{"secret": rfc6238Secret, "issuer": "moneyd", "digits": "6", "period": "30", "algorithm": "SHA1"} {
+		if got := query.Get(name); got != want {
+			t.Errorf("TotpURI() %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 19 || code[4] != '-' || code[9] != '-' || code[14] != '-' {
+		t.Errorf("GenerateRecoveryCode() = %q, want four groups of four", code)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"abcd-efgh-ijkl-mnop", "abcdefghijklmnop"},
+		{" ABCD EFGH-ijkl mnop ", "abcdefghijklmnop"},
+		{"abcdefghijklmnop", "abcdefghijklmnop"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}